@@ -5,9 +5,8 @@ import (
 )
 
 // SimpleCache is a simple in-memory cache that uses a sync.Map to store key-value pairs.
-// It is safe for concurrent use, but it is grow-only.
+// It is safe for concurrent use, but it is grow-only (see LRUCache for a bounded cache).
 type SimpleCache struct {
-	mu    sync.Mutex
 	items sync.Map
 }
 
@@ -30,8 +29,10 @@ func (c *SimpleCache) Set(key string, data string) {
 }
 
 // Clear removes all items from the cache.
+// The items are deleted one by one, because replacing the map would race with Get and Set.
 func (c *SimpleCache) Clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.items = sync.Map{}
+	c.items.Range(func(key, _ any) bool {
+		c.items.Delete(key)
+		return true
+	})
 }
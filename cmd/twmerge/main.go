@@ -0,0 +1,215 @@
+// Command twmerge merges class lists using the rules of one or more stylesheets.
+//
+// Usage:
+//
+//	twmerge -css styles.css [-css other.css] [-mode merge|explain|classes|properties] [class list ...]
+//
+// Every argument is a class list. Without arguments, the class lists are read from stdin, one per line.
+//
+// The modes are:
+//
+//	merge       print the merged class list (default)
+//	explain     print a JSON explanation of the merge, one object per line (see merge.Explanation)
+//	classes     print the known classes, one per line
+//	properties  print the known classes followed by the properties their rules declare
+//
+// In classes and properties mode, the arguments or lines limit the output to the classes they contain.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	merge "github.com/tylantz/go-tailwind-merge"
+)
+
+// stylesheets is a flag that can be repeated to load more than one stylesheet.
+type stylesheets []string
+
+func (s *stylesheets) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stylesheets) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command and returns the exit code.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("twmerge", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var css stylesheets
+	fs.Var(&css, "css", "stylesheet to load (can be repeated)")
+	mode := fs.String("mode", "merge", "output mode: merge, explain, classes or properties")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: twmerge -css styles.css [-css other.css] [-mode merge|explain|classes|properties] [class list ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if len(css) == 0 {
+		fmt.Fprintln(stderr, "twmerge: at least one -css stylesheet is required")
+		fs.Usage()
+		return 2
+	}
+
+	var handle func(m *merge.Merger, w io.Writer, classes string) error
+	switch *mode {
+	case "merge":
+		handle = mergeLine
+	case "explain":
+		handle = explainLine
+	case "classes", "properties":
+		// handled below, the class lists only filter the output
+	default:
+		fmt.Fprintf(stderr, "twmerge: unknown mode %q\n", *mode)
+		fs.Usage()
+		return 2
+	}
+
+	m := merge.NewMerger(nil, true)
+	for _, path := range css {
+		if err := addStylesheet(m, path); err != nil {
+			fmt.Fprintln(stderr, "twmerge:", err)
+			return 1
+		}
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	if handle == nil {
+		filter, err := classFilter(fs.Args(), stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, "twmerge:", err)
+			return 1
+		}
+		listClasses(m, out, filter, *mode == "properties")
+		return 0
+	}
+
+	err := eachClassList(fs.Args(), stdin, func(classes string) error {
+		return handle(m, out, classes)
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, "twmerge:", err)
+		return 1
+	}
+	return 0
+}
+
+func addStylesheet(m *merge.Merger, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := m.AddRules(f, false); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// eachClassList calls fn with every argument, or with every line of stdin if there are no arguments.
+func eachClassList(args []string, stdin io.Reader, fn func(classes string) error) error {
+	if len(args) > 0 {
+		for _, arg := range args {
+			if err := fn(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // class lists can be long
+	for scanner.Scan() {
+		if err := fn(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func mergeLine(m *merge.Merger, w io.Writer, classes string) error {
+	_, err := fmt.Fprintln(w, m.Merge(strings.Join(strings.Fields(classes), " ")))
+	return err
+}
+
+// explanation is an explanation with the class list it explains.
+type explanation struct {
+	Input string `json:"input"`
+	merge.Explanation
+}
+
+func explainLine(m *merge.Merger, w io.Writer, classes string) error {
+	classes = strings.Join(strings.Fields(classes), " ")
+	b, err := json.Marshal(explanation{Input: classes, Explanation: m.Explain(classes)})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// classFilter returns the classes in the arguments or stdin.
+// A nil filter means every class is listed. Stdin is only read if it is not a terminal.
+func classFilter(args []string, stdin io.Reader) (map[string]bool, error) {
+	if len(args) == 0 {
+		if f, ok := stdin.(*os.File); ok {
+			if info, err := f.Stat(); err != nil || info.Mode()&os.ModeCharDevice != 0 {
+				return nil, nil
+			}
+		}
+	}
+	var filter map[string]bool
+	err := eachClassList(args, stdin, func(classes string) error {
+		for _, class := range strings.Fields(classes) {
+			if filter == nil {
+				filter = make(map[string]bool)
+			}
+			filter[class] = true
+		}
+		return nil
+	})
+	return filter, err
+}
+
+// listClasses prints the known classes in alphabetical order.
+// If withProperties is true, each class is followed by the properties its rules declare.
+func listClasses(m *merge.Merger, w io.Writer, filter map[string]bool, withProperties bool) {
+	rules := m.Rules()
+	classes := make([]string, 0, len(rules))
+	for class := range rules {
+		if filter == nil || filter[class] {
+			classes = append(classes, class)
+		}
+	}
+	slices.Sort(classes)
+
+	for _, class := range classes {
+		if !withProperties {
+			fmt.Fprintln(w, class)
+			continue
+		}
+		var props []string
+		for _, rule := range rules[class] {
+			for _, dec := range rule.Declarations {
+				props = append(props, dec.Property)
+			}
+		}
+		slices.Sort(props)
+		fmt.Fprintf(w, "%s\t%s\n", class, strings.Join(slices.Compact(props), " "))
+	}
+}
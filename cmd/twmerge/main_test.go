@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const stylesheet = "../../internal/cascadia/test_resources/test_output.css"
+
+func TestRun(t *testing.T) {
+	tt := []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+		code  int
+	}{
+		{
+			name: "merge arguments",
+			args: []string{"-css", stylesheet, "p-1 p-2", "hover:block hover:inline"},
+			want: "p-2\nhover:inline\n",
+		},
+		{
+			name:  "merge stdin",
+			args:  []string{"-css", stylesheet},
+			stdin: "p-1  p-2\n\nunknown p-1\n",
+			want:  "p-2\n\nunknown p-1\n",
+		},
+		{
+			name: "classes",
+			args: []string{"-css", stylesheet, "-mode", "classes", "p-2 p-1 unknown"},
+			want: "p-1\np-2\n",
+		},
+		{
+			name: "properties",
+			args: []string{"-css", stylesheet, "-mode", "properties", "ring w-fit"},
+			want: "ring\t--tw-ring-offset-shadow --tw-ring-shadow box-shadow\nw-fit\twidth\n",
+		},
+		{
+			name: "no stylesheet",
+			args: []string{"p-1 p-2"},
+			code: 2,
+		},
+		{
+			name: "unknown mode",
+			args: []string{"-css", stylesheet, "-mode", "nope"},
+			code: 2,
+		},
+		{
+			name: "missing stylesheet",
+			args: []string{"-css", "does-not-exist.css", "p-1"},
+			code: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			code := run(tc.args, strings.NewReader(tc.stdin), stdout, stderr)
+			if code != tc.code {
+				t.Fatalf("run returned %d, want %d (stderr: %s)", code, tc.code, stderr)
+			}
+			if got := stdout.String(); got != tc.want {
+				t.Errorf("run printed %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunExplain(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	code := run([]string{"-css", stylesheet, "-mode", "explain"}, strings.NewReader("p-1 p-2\n!font-medium !font-bold\n"), stdout, stderr)
+	if code != 0 {
+		t.Fatalf("run returned %d, want 0 (stderr: %s)", code, stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("run printed %d lines, want 2: %q", len(lines), stdout)
+	}
+	var got []explanation
+	for _, line := range lines {
+		var e explanation
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("invalid JSON %q: %v", line, err)
+		}
+		got = append(got, e)
+	}
+
+	if got[0].Input != "p-1 p-2" || got[0].Result != "p-2" {
+		t.Errorf("got input %q result %q, want input %q result %q", got[0].Input, got[0].Result, "p-1 p-2", "p-2")
+	}
+	if len(got[0].Classes) != 2 || got[0].Classes[0].Kept || !got[0].Classes[1].Kept {
+		t.Errorf("got classes %+v, want p-1 dropped and p-2 kept", got[0].Classes)
+	}
+
+	if got[1].Result != "!font-bold" {
+		t.Errorf("got result %q, want %q", got[1].Result, "!font-bold")
+	}
+	for _, c := range got[1].Classes[0].Conflicts {
+		if c.Winner != "!font-bold" || !c.Important {
+			t.Errorf("got conflict %+v, want !font-bold to win by !important", c)
+		}
+	}
+}
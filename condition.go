@@ -0,0 +1,298 @@
+package merge
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+	"github.com/tylantz/go-tailwind-merge/internal/media"
+)
+
+// Condition is the circumstance in which a rule sets its properties for a class.
+// Two classes only conflict on a property if they set it under equal conditions.
+//
+// A condition is normalized, so rules that apply in the same circumstance have equal conditions even if their selectors
+// or at-rules are written differently: the order of pseudo-classes (:hover:focus and :focus:hover) and of nested at-rules does not matter,
+// :is() and :where() with a single selector are unwrapped (:where(.group):hover is .group:hover),
+// a context written as a pseudo-class of the element (.x:is(.group:hover *)) is the same as a combinator (.group:hover .x),
+// and the whitespace and case of at-rule conditions are normalized. Media queries are compared in the normal form of package media,
+// so (min-width: 768px), (min-width: 48rem) and (width >= 768px) are the same condition.
+type Condition struct {
+	AtRules       []string  // AtRules are the conditional at-rules the rule is nested in, normalized and sorted (e.g., "@media (width >= 640px)")
+	Context       []Context // Context are the other elements the element has to be related to, sorted
+	PseudoClasses []string  // PseudoClasses are the other simple selectors of the element (e.g., ":hover" or "[open]"), sorted and without duplicates
+	PseudoElement string    // PseudoElement is the pseudo-element the properties are set on (e.g., "::before"), if any
+
+	// variants are the variants of a class inferred from its Tailwind name that no rule uses (see SetTailwindFallback)
+	variants string
+}
+
+// Context is another element that the element has to be related to for a rule to apply (e.g., an ancestor with the class dark).
+type Context struct {
+	Selector   string // Selector is the normalized selector of the other element (e.g., ".group:hover"). The class of the rule is written as "&".
+	Combinator string // Combinator is how the element is related to it: " " (descendant), ">" (child), "+" (next sibling) or "~" (subsequent sibling)
+}
+
+// newCondition returns the condition in which a rule sets its properties for a class.
+func newCondition(class string, rule cascadia.CssRule) Condition {
+	c := Condition{AtRules: normalizeAtRules(rule.GetAtRules())}
+	c.addSelector(class, rule.Selector)
+	slices.SortFunc(c.Context, func(a, b Context) int {
+		if n := cmp.Compare(a.Selector, b.Selector); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.Combinator, b.Combinator)
+	})
+	c.Context = slices.Compact(c.Context)
+	slices.Sort(c.PseudoClasses)
+	c.PseudoClasses = slices.Compact(c.PseudoClasses)
+	return c
+}
+
+// addSelector adds the parts of a selector to the condition, except for the class itself.
+func (c *Condition) addSelector(class string, sel cascadia.Sel) {
+	switch t := sel.(type) {
+	case cascadia.CombinedSelector:
+		if t.Second() == nil {
+			c.addSelector(class, t.First())
+			return
+		}
+		c.addContext(class, t.First(), t.Combinator())
+		c.addSelector(class, t.Second())
+	case cascadia.CompoundSelector:
+		for _, s := range t.Selectors() {
+			c.addSelector(class, s)
+		}
+		if pseudo := t.PseudoElement(); pseudo != "" {
+			c.PseudoElement = "::" + pseudo
+		}
+	case cascadia.ClassSelector:
+		if t.Class != class {
+			c.PseudoClasses = append(c.PseudoClasses, normalizeSelector(class, t))
+		}
+	case cascadia.IsPseudoClassSelector:
+		c.addMatchesAny(class, t, t.Selectors())
+	case cascadia.WherePseudoClassSelector:
+		c.addMatchesAny(class, t, t.Selectors())
+	default:
+		c.PseudoClasses = append(c.PseudoClasses, normalizeSelector(class, sel))
+	}
+}
+
+// addMatchesAny adds a pseudo-class that matches any of its selectors (:is or :where) to the condition.
+// A single selector is added as if it was not wrapped (e.g., :is(.dark .x) is .dark .x),
+// and a selector for a related element (e.g., :is(.group:hover *)) is added as context.
+func (c *Condition) addMatchesAny(class string, sel cascadia.Sel, selectors []cascadia.Sel) {
+	if len(selectors) == 1 {
+		if t, ok := selectors[0].(cascadia.CombinedSelector); ok && t.Second() != nil && isUniversal(t.Second()) {
+			c.addContext(class, t.First(), t.Combinator())
+			return
+		}
+		c.addSelector(class, selectors[0])
+		return
+	}
+	c.PseudoClasses = append(c.PseudoClasses, normalizeSelector(class, sel))
+}
+
+// addContext adds an element the element is related to by a combinator.
+func (c *Condition) addContext(class string, sel cascadia.Sel, combinator byte) {
+	// :where(.dark, .dark *) .x is .dark .x, because an element inside .dark is inside .dark
+	if a, ok := selfOrAncestor(sel); ok && combinator == ' ' {
+		sel = a
+	}
+	c.Context = append(c.Context, Context{Selector: normalizeSelector(class, sel), Combinator: string(combinator)})
+}
+
+// selfOrAncestor returns A if sel is :is(A, A *) or :where(A, A *).
+func selfOrAncestor(sel cascadia.Sel) (cascadia.Sel, bool) {
+	var selectors []cascadia.Sel
+	switch t := sel.(type) {
+	case cascadia.IsPseudoClassSelector:
+		selectors = t.Selectors()
+	case cascadia.WherePseudoClassSelector:
+		selectors = t.Selectors()
+	case cascadia.CompoundSelector:
+		if s := t.Selectors(); len(s) == 1 && t.PseudoElement() == "" {
+			return selfOrAncestor(s[0])
+		}
+	}
+	if len(selectors) != 2 {
+		return nil, false
+	}
+	t, ok := selectors[1].(cascadia.CombinedSelector)
+	if !ok || t.Combinator() != ' ' || t.Second() == nil || !isUniversal(t.Second()) || t.First().String() != selectors[0].String() {
+		return nil, false
+	}
+	return selectors[0], true
+}
+
+// isUniversal returns whether sel is the universal selector (*).
+func isUniversal(sel cascadia.Sel) bool {
+	t, ok := sel.(cascadia.CompoundSelector)
+	return ok && len(t.Selectors()) == 0 && t.PseudoElement() == ""
+}
+
+// normalizeSelector returns a selector written in a normal form, with class written as "&".
+// The simple selectors of a compound selector are sorted, and :is() and :where() with a single selector are unwrapped.
+func normalizeSelector(class string, sel cascadia.Sel) string {
+	switch t := sel.(type) {
+	case cascadia.ClassSelector:
+		if t.Class == class {
+			return "&"
+		}
+		return t.String()
+	case cascadia.CombinedSelector:
+		if t.Second() == nil {
+			return normalizeSelector(class, t.First())
+		}
+		first := normalizeSelector(class, t.First())
+		if t.Combinator() == ' ' {
+			return first + " " + normalizeSelector(class, t.Second())
+		}
+		return first + " " + string(t.Combinator()) + " " + normalizeSelector(class, t.Second())
+	case cascadia.CompoundSelector:
+		parts := make([]string, 0, len(t.Selectors()))
+		for _, s := range t.Selectors() {
+			parts = append(parts, normalizeSelector(class, s))
+		}
+		slices.Sort(parts)
+		s := strings.Join(parts, "")
+		if s == "" {
+			s = "*"
+		}
+		if t.PseudoElement() != "" {
+			s += "::" + t.PseudoElement()
+		}
+		return s
+	case cascadia.IsPseudoClassSelector:
+		return normalizeMatchesAny(class, t.Selectors())
+	case cascadia.WherePseudoClassSelector:
+		return normalizeMatchesAny(class, t.Selectors())
+	}
+	return sel.String()
+}
+
+// normalizeMatchesAny returns :is() or :where() with selectors in a normal form.
+// :where() is written as :is(), because they only differ in specificity, which is not part of a condition.
+func normalizeMatchesAny(class string, selectors []cascadia.Sel) string {
+	if len(selectors) == 1 {
+		return normalizeSelector(class, selectors[0])
+	}
+	parts := make([]string, len(selectors))
+	for i, s := range selectors {
+		parts[i] = normalizeSelector(class, s)
+	}
+	slices.Sort(parts)
+	return ":is(" + strings.Join(parts, ", ") + ")"
+}
+
+// normalizeAtRules returns the chain of at-rules in a normal form, sorted.
+// All the conditions of a chain have to match, so the order they are nested in does not matter
+// (e.g., Tailwind v4 nests the @media rules of dark:lg:hover and dark:hover:lg in a different order),
+// and a media query that is implied by another media query of the chain is left out
+// (e.g., the chain of sm:md: is the chain of md:, because (width >= 48rem) implies (width >= 40rem)).
+func normalizeAtRules(atRules []cascadia.AtRule) []string {
+	if len(atRules) == 0 {
+		return nil
+	}
+	normalized := make([]string, 0, len(atRules))
+	lists := make([]media.List, len(atRules)) // the parsed @media queries, nil for other at-rules and queries that do not parse
+	for i, a := range atRules {
+		if strings.EqualFold(a.Name, "@media") {
+			if list, err := media.Parse(a.Condition); err == nil {
+				lists[i] = list
+			}
+		}
+	}
+	for i, a := range atRules {
+		name := strings.ToLower(a.Name)
+		condition := normalizeAtRuleCondition(a.Condition)
+		if name == "@media" || name == "@container" {
+			condition = strings.ToLower(condition)
+		}
+		if lists[i] != nil {
+			if impliedByChain(lists, i) {
+				continue
+			}
+			// queries that match the same media have the same normal form (e.g., (min-width: 48rem) and (width >= 768px))
+			condition = lists[i].String()
+		}
+		normalized = append(normalized, name+" "+condition)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// impliedByChain returns whether the media query lists[i] is implied by another media query of the chain,
+// so it adds nothing to the chain. Of equivalent queries, the first is kept.
+func impliedByChain(lists []media.List, i int) bool {
+	for j, l := range lists {
+		if j == i || l == nil || !l.Implies(lists[i]) {
+			continue
+		}
+		if j < i || !l.Equivalent(lists[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAtRuleCondition collapses whitespace in the condition of an at-rule
+// and removes it inside parentheses and next to colons, commas and comparisons (e.g., "( min-width : 640px )" is "(min-width:640px)").
+func normalizeAtRuleCondition(condition string) string {
+	fields := strings.Fields(condition)
+	b := strings.Builder{}
+	for i, f := range fields {
+		if i > 0 && !strings.ContainsAny(f[:1], "):,<>=") && !strings.ContainsAny(fields[i-1][len(fields[i-1])-1:], "(:,<>=") {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f)
+	}
+	return b.String()
+}
+
+// IsZero returns whether the condition is empty, which means the properties are set on the element in any circumstance.
+func (c Condition) IsZero() bool {
+	return len(c.AtRules) == 0 && len(c.Context) == 0 && len(c.PseudoClasses) == 0 && c.PseudoElement == "" && c.variants == ""
+}
+
+// Equal returns whether two conditions are the same circumstance.
+func (c Condition) Equal(o Condition) bool {
+	return slices.Equal(c.AtRules, o.AtRules) && slices.Equal(c.Context, o.Context) && slices.Equal(c.PseudoClasses, o.PseudoClasses) &&
+		c.PseudoElement == o.PseudoElement && c.variants == o.variants
+}
+
+// String returns the condition in its normal form, which is the same for equal conditions.
+// The element is written as "&" if it has a context (e.g., "@media (width >= 640px) .group:hover &:focus" or ":hover::before").
+func (c Condition) String() string {
+	b := strings.Builder{}
+	b.WriteString(strings.Join(c.AtRules, " and "))
+	space := func() {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+	}
+	for _, ctx := range c.Context {
+		space()
+		b.WriteString(ctx.Selector)
+		if ctx.Combinator != " " {
+			b.WriteString(" " + ctx.Combinator)
+		}
+	}
+	if len(c.Context) > 0 {
+		space()
+		b.WriteByte('&')
+	} else if len(c.PseudoClasses) > 0 || c.PseudoElement != "" {
+		space()
+	}
+	for _, p := range c.PseudoClasses {
+		b.WriteString(p)
+	}
+	b.WriteString(c.PseudoElement)
+	if c.variants != "" {
+		space()
+		b.WriteString(c.variants + ":")
+	}
+	return b.String()
+}
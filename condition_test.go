@@ -0,0 +1,211 @@
+package merge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+)
+
+// parseCondition returns the condition of the first rule of css for class.
+func parseCondition(t *testing.T, class, css string) Condition {
+	t.Helper()
+	sheet, err := cascadia.ExtractStylesheet(strings.NewReader(css), false)
+	if err != nil {
+		t.Fatalf("ExtractStylesheet returned error: %v", err)
+	}
+	if len(sheet.Rules) == 0 {
+		t.Fatalf("no rule in %q", css)
+	}
+	return newCondition(class, sheet.Rules[0])
+}
+
+func TestCondition(t *testing.T) {
+	tt := []struct {
+		name string
+		css  string
+		want Condition
+		str  string
+	}{
+		{
+			name: "class",
+			css:  `.x { padding: 0; }`,
+			want: Condition{},
+			str:  "",
+		},
+		{
+			name: "pseudo-classes are a set",
+			css:  `.x:hover:focus:hover::before { padding: 0; }`,
+			want: Condition{PseudoClasses: []string{":focus", ":hover"}, PseudoElement: "::before"},
+			str:  ":focus:hover::before",
+		},
+		{
+			name: "repeated class",
+			css:  `.x.x:hover { padding: 0; }`,
+			want: Condition{PseudoClasses: []string{":hover"}},
+			str:  ":hover",
+		},
+		{
+			name: "at-rules are normalized and sorted",
+			css:  `@media ( MIN-WIDTH : 640px ) { @supports (display: grid) { .x { padding: 0; } } }`,
+			want: Condition{AtRules: []string{"@media (width >= 640px)", "@supports (display:grid)"}},
+			str:  "@media (width >= 640px) and @supports (display:grid)",
+		},
+		{
+			name: "ancestor",
+			css:  `@media (min-width: 640px) { .group:hover .x:focus { padding: 0; } }`,
+			want: Condition{AtRules: []string{"@media (width >= 640px)"}, Context: []Context{{Selector: ".group:hover", Combinator: " "}}, PseudoClasses: []string{":focus"}},
+			str:  "@media (width >= 640px) .group:hover &:focus",
+		},
+		{
+			name: "sibling",
+			css:  `.peer:checked ~ .x { padding: 0; }`,
+			want: Condition{Context: []Context{{Selector: ".peer:checked", Combinator: "~"}}},
+			str:  ".peer:checked ~ &",
+		},
+		{
+			name: "context class",
+			css:  `.x > .y { padding: 0; }`,
+			want: Condition{Context: []Context{{Selector: "&", Combinator: ">"}}, PseudoClasses: []string{".y"}},
+			str:  "& > &.y",
+		},
+		{
+			name: "self or ancestor",
+			css:  `.x:where(.dark, .dark *) { padding: 0; }`,
+			want: Condition{PseudoClasses: []string{":is(.dark, .dark *)"}},
+			str:  ":is(.dark, .dark *)",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseCondition(t, "x", tc.css)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("newCondition returned %#v, want %#v", got, tc.want)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("Equal returned false for %#v", got)
+			}
+			if got.IsZero() != (tc.str == "") {
+				t.Errorf("IsZero returned %v", got.IsZero())
+			}
+			if s := got.String(); s != tc.str {
+				t.Errorf("String returned %q, want %q", s, tc.str)
+			}
+		})
+	}
+}
+
+func TestConditionEqual(t *testing.T) {
+	tt := []struct {
+		a, b  string
+		equal bool
+	}{
+		{a: `.x:hover:focus { padding: 0; }`, b: `.x:focus:hover { padding: 0; }`, equal: true},
+		{a: `@media (min-width: 640px) { .x { padding: 0; } }`, b: `@media (min-width:640px) { .x { padding: 0; } }`, equal: true},
+		{a: `@media (width >= 40rem) { .x { padding: 0; } }`, b: `@media (width>=40rem) { .x { padding: 0; } }`, equal: true},
+		{a: `@media (min-width: 640px) { .x { padding: 0; } }`, b: `@media (width >= 40rem) { .x { padding: 0; } }`, equal: true},
+		{a: `@media not all and (min-width: 640px) { .x { padding: 0; } }`, b: `@media (width < 40em) { .x { padding: 0; } }`, equal: true},
+		{a: `@media (min-width: 640px) { .x { padding: 0; } }`, b: `@media (min-width: 768px) { .x { padding: 0; } }`, equal: false},
+		{a: `@media (min-width: 640px) { @media (min-width: 768px) { .x { padding: 0; } } }`, b: `@media (width >= 48rem) { .x { padding: 0; } }`, equal: true},
+		{a: `@media (min-width: 640px) { @media (min-width: 640px) { .x { padding: 0; } } }`, b: `@media (width >= 40rem) { .x { padding: 0; } }`, equal: true},
+		{a: `@media (min-width: 640px) { @media (hover: hover) { .x { padding: 0; } } }`, b: `@media (hover: hover) { .x { padding: 0; } }`, equal: false},
+		{a: `.dark .x { padding: 0; }`, b: `:where(.dark, .dark *) .x { padding: 0; }`, equal: true},
+		{a: `.dark .x { padding: 0; }`, b: `:is(.dark .x) { padding: 0; }`, equal: true},
+		{a: `.group:hover .x { padding: 0; }`, b: `.x:is(:where(.group):hover *) { padding: 0; }`, equal: true},
+		{a: `.peer:hover ~ .x { padding: 0; }`, b: `.x:is(:where(.peer):hover ~ *) { padding: 0; }`, equal: true},
+		{a: `.x { padding: 0; }`, b: `.x::before { padding: 0; }`, equal: false},
+		{a: `.dark .x { padding: 0; }`, b: `.dark > .x { padding: 0; }`, equal: false},
+		{a: `.dark .x { padding: 0; }`, b: `.x:where(.dark, .dark *) { padding: 0; }`, equal: false},
+		{a: `@media (min-width: 640px) { .x { padding: 0; } }`, b: `@supports (min-width: 640px) { .x { padding: 0; } }`, equal: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			a := parseCondition(t, "x", tc.a)
+			b := parseCondition(t, "x", tc.b)
+			if got := a.Equal(b); got != tc.equal {
+				t.Errorf("Equal returned %v for %q and %q, want %v", got, a, b, tc.equal)
+			}
+			if got := a.String() == b.String(); got != tc.equal {
+				t.Errorf("String returned %q and %q", a, b)
+			}
+		})
+	}
+}
+
+func TestMergeNormalizedConditions(t *testing.T) {
+	rules := `
+	.dark .dark\:p-1 {
+		padding: 0.25rem;
+	}
+	:where(.dark, .dark *) .dark\:p-2 {
+		padding: 0.5rem;
+	}
+	.group:hover .group-hover\:p-1 {
+		padding: 0.25rem;
+	}
+	.group-hover\:p-2:is(:where(.group):hover *) {
+		padding: 0.5rem;
+	}
+	.hover\:focus\:p-1:hover:focus {
+		padding: 0.25rem;
+	}
+	.focus\:hover\:p-2:focus:hover {
+		padding: 0.5rem;
+	}
+	@media (min-width: 640px) {
+		.sm\:p-1 {
+			padding: 0.25rem;
+		}
+	}
+	@media (min-width:640px) {
+		.sm\:p-2 {
+			padding: 0.5rem;
+		}
+	}
+	@media (width >= 40rem) {
+		.sm\:p-3 {
+			padding: 0.75rem;
+		}
+	}
+	@media (width >= 48rem) {
+		.md\:p-1 {
+			padding: 0.25rem;
+		}
+	}
+	@media (width >= 40rem) {
+		@media (width >= 48rem) {
+			.sm\:md\:p-2 {
+				padding: 0.5rem;
+			}
+		}
+	}
+	`
+	r := NewMerger(nil, true)
+	if err := r.AddRules(strings.NewReader(rules), false); err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		// the :where() rules have a lower specificity, so they lose whatever the order of the classes
+		{in: "dark:p-1 dark:p-2", want: "dark:p-1"},
+		{in: "dark:p-2 dark:p-1", want: "dark:p-1"},
+		{in: "group-hover:p-1 group-hover:p-2", want: "group-hover:p-1"},
+		{in: "hover:focus:p-1 focus:hover:p-2", want: "focus:hover:p-2"},
+		{in: "sm:p-1 sm:p-2", want: "sm:p-2"},
+		{in: "sm:p-3 sm:p-1", want: "sm:p-1"},
+		{in: "md:p-1 sm:md:p-2", want: "sm:md:p-2"},
+		{in: "sm:p-1 sm:md:p-2", want: "sm:p-1 sm:md:p-2"},
+		{in: "dark:p-1 group-hover:p-2 hover:focus:p-1 sm:p-2", want: "dark:p-1 group-hover:p-2 hover:focus:p-1 sm:p-2"},
+	}
+	for _, tc := range tt {
+		if got := r.Merge(tc.in); got != tc.want {
+			t.Errorf("Merge(%q) returned %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
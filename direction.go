@@ -0,0 +1,42 @@
+package merge
+
+import "github.com/tylantz/go-tailwind-merge/internal/props"
+
+// Direction is the inline base direction of the documents the classes are used in (see SetDirection).
+type Direction int
+
+const (
+	DirectionUnknown Direction = iota // the direction or the writing mode is not known, the default
+	DirectionLTR                      // left to right, in a horizontal writing mode
+	DirectionRTL                      // right to left, in a horizontal writing mode
+)
+
+// SetDirection sets the direction of the documents the classes are used in,
+// which decides how logical properties (e.g., padding-inline-start) relate to physical properties (e.g., padding-left).
+//
+// With DirectionLTR or DirectionRTL, a logical property is the physical property it maps to in a horizontal writing mode,
+// so ps-4 and pl-2 conflict in LTR, and ps-4 and pr-2 conflict in RTL.
+// With DirectionUnknown, the default, the side a logical property maps to is not known, so logical and physical properties
+// only conflict if the physical properties set every side of a box (e.g., p-2 overrides an earlier ps-4, but pl-2 does not).
+// The logical dimensions of a box do not depend on the direction, so they conflict with the physical dimensions in any direction
+// (e.g., size-4, which is inline-size and block-size in Tailwind v4, overrides an earlier w-4).
+// Logical properties always conflict with each other (e.g., ps-4 and px-2 in Tailwind v4, where px-2 is padding-inline).
+//
+// Setting the direction clears the cache.
+func (r *Merger) SetDirection(dir Direction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.direction = dir
+	r.publish(r.rules.Load().clone())
+}
+
+// propsDirection returns the direction in the terms of package props.
+func (d Direction) propsDirection() props.Direction {
+	switch d {
+	case DirectionLTR:
+		return props.LTR
+	case DirectionRTL:
+		return props.RTL
+	}
+	return props.DirectionUnknown
+}
@@ -0,0 +1,111 @@
+package merge
+
+import (
+	"slices"
+	"strings"
+)
+
+// Explanation describes how Merge resolved a class string.
+type Explanation struct {
+	Result  string             `json:"result"`  // Result is the merged class string, as returned by Merge
+	Classes []ClassExplanation `json:"classes"` // Classes has an explanation for each distinct input class, in input order
+}
+
+// ClassExplanation describes why a class was kept or dropped.
+type ClassExplanation struct {
+	Class     string     `json:"class"`               // Class is the class name
+	Known     bool       `json:"known"`               // Known is false if no rule uses the class, as its subject or in its context (e.g., group). Unknown classes are kept, unless what they set is inferred.
+	Inferred  bool       `json:"inferred"`            // Inferred is true if what the class sets was inferred from its Tailwind name (see Merger.SetTailwindFallback)
+	Kept      bool       `json:"kept"`                // Kept is true if the class is in the result
+	Conflicts []Conflict `json:"conflicts,omitempty"` // Conflicts are the properties the class sets that other input classes set as well
+}
+
+// Conflict is a property set by more than one class under the same condition, and the class that wins it.
+type Conflict struct {
+	Property  string   `json:"property"`         // Property is the computed property (e.g., "padding-top" for padding)
+	Condition string   `json:"condition"`        // Condition is the circumstance the property is set in (e.g., ":hover" or "@media (min-width:640px)")
+	Classes   []string `json:"classes"`          // Classes are the input classes that set the property under the condition, in input order
+	Winner    string   `json:"winner,omitempty"` // Winner is the class that wins the property. It is empty if no class keeps it (see CustomProperty).
+
+	// Important is true if the winner sets the property with !important, which wins over the classes that set it without.
+	Important bool `json:"important"`
+	// CustomProperty is true if the property is a custom property (e.g., --tw-ring-color).
+	// The class that sets a custom property last only wins it if the custom property is used by a property that is kept.
+	CustomProperty bool `json:"customProperty"`
+	// Used is true if the custom property is used by a property that is kept,
+	// directly or through the value of another used custom property (e.g., --tw-ring-color through --tw-ring-shadow).
+	Used bool `json:"used"`
+}
+
+// Explain resolves a class string like Merge does and reports why each class was kept or dropped.
+// It is meant for debugging and does not use the cache.
+func (r *Merger) Explain(inClass string) Explanation {
+	rs := r.rules.Load()
+	res := r.getResolution(rs)
+	defer r.putResolution(res)
+	res.split = splitClasses(res.split, inClass)
+	split := res.split
+	rs.resolve(res)
+
+	exp := Explanation{Result: inClass}
+	if len(split) > 1 {
+		exp.Result = r.join(split, res.keep())
+	}
+	kept := make(map[string]bool, len(split))
+	for _, class := range strings.Split(exp.Result, " ") {
+		kept[class] = true
+	}
+
+	// the classes that set each property under each condition, in input order
+	setBy := make(map[int][]string)
+	for _, class := range split {
+		fp, _ := rs.footprint(res, class)
+		for _, s := range fp {
+			if !slices.Contains(setBy[s.key], class) {
+				setBy[s.key] = append(setBy[s.key], class)
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(split))
+	for _, class := range split {
+		if class == "" || seen[class] {
+			continue
+		}
+		seen[class] = true
+
+		_, subject := rs.rules[class]
+		_, context := rs.contexts[class]
+		fp, ok := rs.footprint(res, class)
+		c := ClassExplanation{Class: class, Known: subject || context, Inferred: ok && !subject, Kept: kept[class]}
+		added := make(map[int]bool)
+		for _, s := range fp {
+			if len(setBy[s.key]) < 2 || added[s.key] {
+				continue
+			}
+			added[s.key] = true
+			c.Conflicts = append(c.Conflicts, rs.conflict(res, s.key, setBy[s.key]))
+		}
+		exp.Classes = append(exp.Classes, c)
+	}
+	return exp
+}
+
+// conflict explains which class wins a property set by more than one class.
+func (rs *ruleSet) conflict(res *resolution, key int, classes []string) Conflict {
+	k := rs.key(res, key)
+	c := Conflict{Property: k.property, Condition: k.condition.String(), Classes: classes}
+	e := res.entries[res.slots[key]-1]
+	c.Important = e.important
+	switch {
+	case e.custom:
+		c.CustomProperty = true
+		c.Used = e.used
+		if c.Used {
+			c.Winner = e.winner
+		}
+	default:
+		c.Winner = e.winner
+	}
+	return c
+}
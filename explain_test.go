@@ -0,0 +1,156 @@
+package merge
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	rules := `
+	.p-1 {
+		padding: 0.25rem;
+	}
+	.p-2 {
+		padding: 0.5rem;
+	}
+	.p-3Important {
+		padding: 0.75rem !important;
+	}
+	.hover\:p-2:hover {
+		padding: 0.5rem;
+	}
+	.shadow {
+		--tw-shadow: 0 1px 3px 0 rgb(0 0 0 / 0.1);
+		box-shadow: var(--tw-ring-shadow, 0 0 #0000), var(--tw-shadow);
+	}
+	.ring {
+		--tw-ring-shadow: 0 0 0 3px blue;
+		box-shadow: var(--tw-ring-shadow), var(--tw-shadow, 0 0 #0000);
+	}
+	.ring-2 {
+		--tw-ring-shadow: 0 0 0 2px blue;
+		box-shadow: var(--tw-ring-shadow), var(--tw-shadow, 0 0 #0000);
+	}
+	.unused-var {
+		--tw-unused: 1;
+	}
+	.unused-var-2 {
+		--tw-unused: 2;
+	}
+	.group:hover .group-hover\:p-1 {
+		padding: 0.25rem;
+	}
+	`
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	type want struct {
+		class     string
+		known     bool
+		kept      bool
+		property  string // a conflicting property of the class, if any
+		condition string
+		conflict  Conflict
+	}
+
+	tt := []struct {
+		in     string
+		result string
+		want   []want
+	}{
+		{
+			in:     "p-1 p-2",
+			result: "p-2",
+			want: []want{
+				{class: "p-1", known: true, property: "padding-top", conflict: Conflict{Classes: []string{"p-1", "p-2"}, Winner: "p-2"}},
+				{class: "p-2", known: true, kept: true, property: "padding-top", conflict: Conflict{Classes: []string{"p-1", "p-2"}, Winner: "p-2"}},
+			},
+		},
+		{
+			in:     "p-3Important p-2 hover:p-2",
+			result: "p-3Important hover:p-2",
+			want: []want{
+				{class: "p-3Important", known: true, kept: true, property: "padding-left", conflict: Conflict{Classes: []string{"p-3Important", "p-2"}, Winner: "p-3Important", Important: true}},
+				{class: "p-2", known: true, property: "padding-left", conflict: Conflict{Classes: []string{"p-3Important", "p-2"}, Winner: "p-3Important", Important: true}},
+				// hover:p-2 does not conflict with p-2
+				{class: "hover:p-2", known: true, kept: true},
+			},
+		},
+		{
+			in:     "ring ring-2 shadow",
+			result: "ring-2 shadow",
+			want: []want{
+				{class: "ring", known: true, property: "--tw-ring-shadow", conflict: Conflict{Classes: []string{"ring", "ring-2"}, Winner: "ring-2", CustomProperty: true, Used: true}},
+				{class: "ring-2", known: true, kept: true, property: "box-shadow", conflict: Conflict{Classes: []string{"ring", "ring-2", "shadow"}, Winner: "shadow"}},
+				{class: "shadow", known: true, kept: true, property: "box-shadow", conflict: Conflict{Classes: []string{"ring", "ring-2", "shadow"}, Winner: "shadow"}},
+			},
+		},
+		{
+			in:     "unused-var unused-var-2 unknown",
+			result: "unknown",
+			want: []want{
+				{class: "unused-var", known: true, property: "--tw-unused", conflict: Conflict{Classes: []string{"unused-var", "unused-var-2"}, CustomProperty: true}},
+				{class: "unused-var-2", known: true, property: "--tw-unused", conflict: Conflict{Classes: []string{"unused-var", "unused-var-2"}, CustomProperty: true}},
+				{class: "unknown", kept: true},
+			},
+		},
+		{
+			in:     "group group-hover:p-1 p-1",
+			result: "group group-hover:p-1 p-1",
+			want: []want{
+				// group is only used in the context of group-hover:p-1, so it is known but sets nothing
+				{class: "group", known: true, kept: true},
+				{class: "group-hover:p-1", known: true, kept: true},
+				{class: "p-1", known: true, kept: true},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			got := r.Explain(tc.in)
+			if got.Result != tc.result {
+				t.Errorf("Explain(%q).Result = %q, want %q", tc.in, got.Result, tc.result)
+			}
+			if got.Result != r.Merge(tc.in) {
+				t.Errorf("Explain(%q).Result = %q, Merge returned %q", tc.in, got.Result, r.Merge(tc.in))
+			}
+			if len(got.Classes) != len(tc.want) {
+				t.Fatalf("Explain(%q) explained %d classes, want %d", tc.in, len(got.Classes), len(tc.want))
+			}
+			for i, w := range tc.want {
+				c := got.Classes[i]
+				if c.Class != w.class || c.Known != w.known || c.Kept != w.kept {
+					t.Errorf("class %d: got %s known %v kept %v, want %s known %v kept %v", i, c.Class, c.Known, c.Kept, w.class, w.known, w.kept)
+				}
+				if w.property == "" {
+					if len(c.Conflicts) != 0 {
+						t.Errorf("class %s: got conflicts %v, want none", c.Class, c.Conflicts)
+					}
+					continue
+				}
+				idx := slices.IndexFunc(c.Conflicts, func(conflict Conflict) bool {
+					return conflict.Property == w.property && conflict.Condition == w.condition
+				})
+				if idx < 0 {
+					t.Errorf("class %s: no conflict on %q, got %v", c.Class, w.property, c.Conflicts)
+					continue
+				}
+				conflict := c.Conflicts[idx]
+				w.conflict.Property = w.property
+				w.conflict.Condition = w.condition
+				if !slices.Equal(conflict.Classes, w.conflict.Classes) {
+					t.Errorf("class %s: conflict on %q between %v, want %v", c.Class, w.property, conflict.Classes, w.conflict.Classes)
+				}
+				if !reflect.DeepEqual(conflict, w.conflict) {
+					t.Errorf("class %s: got conflict %+v, want %+v", c.Class, conflict, w.conflict)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package merge
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+)
+
+// footprint is what the rules of a class set, precompiled by AddRules so that Merge does not look at the rules.
+// It has a setting for each property of each rule of the class, in the order of the rules.
+type footprint []classSetting
+
+// classSetting is a property set by a rule of a class under a condition.
+type classSetting struct {
+	key         int  // the property and the condition (see keyTable)
+	custom      bool // the property is a custom property (e.g., --tw-ring-color)
+	layer       int  // the layer rank of the rule
+	specificity cascadia.Specificity
+	important   bool  // the declaration that sets the property is !important
+	uses        []int // the custom properties used by the value of the property (see propertyKey.variable)
+}
+
+// keyTable interns the properties set by the rules and the condition they are set in (see Condition),
+// so that they can be compared as integers.
+// A custom property used by a value (e.g., var(--tw-ring-color)) is interned without a condition,
+// so it is the same key as the custom property set outside of any condition,
+// and every key of a custom property refers to that key as its variable.
+//
+// The uses of the custom properties make a dependency graph of the variables:
+// the settings of a custom property use the variables its value refers to
+// (e.g., --tw-ring-shadow uses --tw-ring-offset-width and --tw-ring-color),
+// including the variables in fallbacks and nested var() (e.g., var(--a, var(--b))).
+type keyTable struct {
+	ids  map[string]int
+	keys []propertyKey
+}
+
+// propertyKey is a property and the condition it is set in.
+type propertyKey struct {
+	property  string
+	condition Condition
+	variable  int // the key of the custom property without a condition, -1 if the property is not a custom property
+}
+
+func newKeyTable() keyTable {
+	return keyTable{ids: make(map[string]int)}
+}
+
+// id returns the key of a property and a condition, adding it if it is new.
+// Equal conditions have the same key.
+func (t *keyTable) id(property string, condition Condition) int {
+	s := property + condition.String()
+	if id, ok := t.ids[s]; ok {
+		return id
+	}
+	// a custom property set in a condition refers to the key of the custom property without a condition
+	variable := -1
+	if strings.HasPrefix(property, "--") && !condition.IsZero() {
+		variable = t.id(property, Condition{})
+	}
+	id := len(t.keys)
+	if strings.HasPrefix(property, "--") && condition.IsZero() {
+		variable = id
+	}
+	t.ids[s] = id
+	t.keys = append(t.keys, propertyKey{property: property, condition: condition, variable: variable})
+	return id
+}
+
+// compile precompiles the footprint of every class of a rule set.
+// Every footprint is compiled again when rules are added, because a new layer can change the rank of the layers before it.
+func (r *Merger) compile(rs *ruleSet) {
+	rs.keys = newKeyTable()
+	rs.direction = r.direction
+	rs.footprints = make(map[string]footprint, len(rs.rules))
+	for class, rules := range rs.rules {
+		fp := make(footprint, 0, len(rules))
+		for _, rule := range rules {
+			condition := newCondition(class, rule)
+			layer := rs.layers.get(rule.GetLayer())
+			specificity := rule.Selector.Specificity()
+
+			start := len(fp)
+			for _, dec := range rule.Declarations {
+				var uses []int
+				for _, v := range getCustomVarsInDec(dec) {
+					uses = append(uses, rs.keys.id(v, Condition{}))
+				}
+				for _, prop := range r.appendDeclarationProps(nil, dec, rs.direction) {
+					key := rs.keys.id(prop, condition)
+					// a property set twice by a rule (e.g., a fallback value) is set by the last declaration,
+					// unless only the first one is !important
+					if i := slices.IndexFunc(fp[start:], func(s classSetting) bool { return s.key == key }); i >= 0 {
+						if s := &fp[start+i]; dec.Important || !s.important {
+							s.important = dec.Important
+							s.uses = uses
+						}
+						continue
+					}
+					fp = append(fp, classSetting{
+						key:         key,
+						custom:      strings.HasPrefix(prop, "--"),
+						layer:       layer,
+						specificity: specificity,
+						important:   dec.Important,
+						uses:        uses,
+					})
+				}
+			}
+		}
+		rs.footprints[class] = fp
+	}
+
+	rs.fallback = nil
+	if r.tailwindFallback {
+		rs.fallback = r.newTailwindFallback(rs)
+	}
+}
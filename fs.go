@@ -0,0 +1,110 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+)
+
+// SourceError is an error reading or parsing a named stylesheet (e.g., a file).
+type SourceError struct {
+	Source string // Source is the name of the stylesheet (e.g., "css/output.css")
+	Err    error  // Err is the error reading or parsing the stylesheet
+}
+
+func (e *SourceError) Error() string {
+	return e.Source + ": " + e.Err.Error()
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// AddRulesFS adds the rules of the stylesheet files in fsys that match patterns (see fs.Glob for the syntax),
+// so embedded files (embed.FS) and directories (os.DirFS) can be loaded without opening each file.
+//
+// The files are added in this order, which matters for the cascade (e.g., for the order of layers and of rules with the same specificity):
+//   - the files of each pattern are added in the order the patterns are given
+//   - the files that match a pattern are added in lexical order of their path
+//   - a file that matches more than one pattern is added once, where it is first matched
+//
+// Each file is a source named by its path in fsys (see Sources and cascadia.CssRule.GetSource).
+// Every file is read and parsed before anything is changed. If any of them fails, nothing is added and the error
+// has a *SourceError for each file that failed (see errors.Join). A pattern that is malformed or matches no file is an error as well.
+// Otherwise the files are added like one stylesheet passed to AddRules.
+func (r *Merger) AddRulesFS(fsys fs.FS, patterns ...string) error {
+	var names []string
+	var errs []error
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pattern %q: %w", pattern, err))
+			continue
+		}
+		if len(matches) == 0 {
+			errs = append(errs, fmt.Errorf("pattern %q matches no files", pattern))
+			continue
+		}
+		slices.Sort(matches)
+		for _, name := range matches {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	sheets := make([]cascadia.Stylesheet, 0, len(names))
+	for _, name := range names {
+		sheet, err := parseFS(fsys, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sheets = append(sheets, sheet)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := r.rules.Load().clone()
+	for i, sheet := range sheets {
+		next.addSource(names[i], sheet)
+	}
+	r.publish(next)
+	return nil
+}
+
+// parseFS parses the stylesheet file name in fsys. The error is a *SourceError.
+func parseFS(fsys fs.FS, name string) (cascadia.Stylesheet, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return cascadia.Stylesheet{}, &SourceError{Source: name, Err: err}
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return cascadia.Stylesheet{}, &SourceError{Source: name, Err: errors.New("is a directory")}
+	}
+	sheet, err := cascadia.ExtractStylesheet(f, false)
+	if err != nil {
+		return cascadia.Stylesheet{}, &SourceError{Source: name, Err: err}
+	}
+	return sheet, nil
+}
+
+// addSource adds a stylesheet named name to a rule set that is not in use yet (see add).
+func (rs *ruleSet) addSource(name string, sheet cascadia.Stylesheet) {
+	sheet.SetSource(name)
+	rs.add(sheet)
+	rs.sources = append(rs.sources, name)
+}
+
+// Sources returns the names of the stylesheets loaded by AddRulesFS and WatchFiles, in the order they were added.
+// A file that is loaded again is listed again. Stylesheets added with AddRules have no name and are not listed.
+func (r *Merger) Sources() []string {
+	return slices.Clone(r.rules.Load().sources)
+}
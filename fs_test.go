@@ -0,0 +1,83 @@
+package merge
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAddRulesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"css/b.css":      {Data: []byte(`@layer utilities { .p-2 { padding: 0.5rem; } } .m-1 { margin: 0.25rem; }`)},
+		"css/a.css":      {Data: []byte(`@layer components { .p-1 { padding: 0.25rem; } }`)},
+		"css/broken.txt": {Data: []byte(`.p-1 { padding: 0.25rem; }}`)},
+		"base.css":       {Data: []byte(`@layer base, components; @layer components { .card { padding: 1rem; } } @layer base { .box { padding: 2rem; } }`)},
+	}
+
+	r := NewMerger(nil, true)
+	err := r.AddRulesFS(fsys, "base.css", "css/*.css", "css/a.css")
+	if err != nil {
+		t.Fatalf("AddRulesFS returned error: %v", err)
+	}
+
+	want := []string{"base.css", "css/a.css", "css/b.css"}
+	if got := r.Sources(); !slices.Equal(got, want) {
+		t.Errorf("Sources returned %v, want %v", got, want)
+	}
+	if got := r.Rules()["m-1"][0].GetSource(); got != "css/b.css" {
+		t.Errorf("GetSource returned %q, want %q", got, "css/b.css")
+	}
+
+	// the layers are declared in the order the files are added
+	tt := []struct {
+		in   string
+		want string
+	}{
+		{in: "p-2 p-1", want: "p-2"},
+		{in: "card box", want: "card"},
+	}
+	for _, tc := range tt {
+		if got := r.Merge(tc.in); got != tc.want {
+			t.Errorf("Merge(%q) returned %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestAddRulesFSErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.css":      {Data: []byte(`.p-1 { padding: 0.25rem; } .p-2 { padding: 0.5rem; }`)},
+		"broken.css": {Data: []byte(`.m-1 { margin: 0.25rem; }}`)},
+		"dir/c.css":  {Data: []byte(`.m-2 { margin: 0.5rem; }`)},
+	}
+
+	r := NewMerger(nil, true)
+	err := r.AddRulesFS(fsys, "*.css", "missing/*.css", "[")
+	if err == nil {
+		t.Fatal("AddRulesFS returned no error")
+	}
+	var srcErr *SourceError
+	if !errors.As(err, &srcErr) || srcErr.Source != "broken.css" {
+		t.Errorf("AddRulesFS returned %v, want a *SourceError for broken.css", err)
+	}
+	for _, s := range []string{"missing/*.css", `"["`} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("AddRulesFS returned %v, want an error for pattern %s", err, s)
+		}
+	}
+
+	// nothing is added if a file fails
+	if len(r.Rules()) != 0 || len(r.Sources()) != 0 {
+		t.Errorf("AddRulesFS added rules from %v", r.Sources())
+	}
+	if got := r.Merge("p-1 p-2"); got != "p-1 p-2" {
+		t.Errorf("Merge returned %q, want %q", got, "p-1 p-2")
+	}
+
+	// a directory is not a stylesheet
+	err = r.AddRulesFS(fsys, "d*")
+	if !errors.As(err, &srcErr) || srcErr.Source != "dir" {
+		t.Errorf("AddRulesFS returned %v, want a *SourceError for dir", err)
+	}
+}
@@ -0,0 +1,339 @@
+package cascadia
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+/*
+	The stylesheet is read in two steps. First, the tokens from the lexer are grouped into a tree of nodes
+	(at-rules, qualified rules and declarations) following https://www.w3.org/TR/css-syntax-3/#parsing.
+	Then the tree is walked to flatten nested rules into CssRules (see ExtractStylesheet).
+
+	Blocks are parsed the way CSS nesting does it: an item in a block is a declaration,
+	unless it ends with a {} block, in which case it is a nested rule.
+	See https://drafts.csswg.org/css-nesting/#syntax
+*/
+
+// nodeKind is the kind of an item in a stylesheet or a {} block.
+type nodeKind int
+
+const (
+	declarationNode   nodeKind = iota // a property and a value (e.g., color: red)
+	qualifiedRuleNode                 // a selector and a block (e.g., .a { ... })
+	atRuleNode                        // an at-rule and an optional block (e.g., @media (...) { ... } or @layer a, b;)
+)
+
+// cssNode is an item in a stylesheet or a {} block.
+type cssNode struct {
+	kind      nodeKind
+	name      string      // name of an at-rule (e.g., "@media") or the property of a declaration
+	prelude   []css.Token // at-rule prelude, selector or declaration value
+	important bool        // the declaration value ends with !important, which is not in the prelude
+	block     []cssNode   // contents of the {} block
+	hasBlock  bool        // at-rules may end with a semicolon instead of a block
+	offset    int         // offset of the node in the input, for error messages
+}
+
+// tokenStream reads tokens from the lexer with one token of lookahead.
+type tokenStream struct {
+	l      *css.Lexer
+	r      *parse.Input
+	peeked bool
+	tt     css.TokenType
+	data   []byte
+}
+
+func newTokenStream(r io.Reader) *tokenStream {
+	input := parse.NewInput(r)
+	return &tokenStream{l: css.NewLexer(input), r: input}
+}
+
+func (s *tokenStream) next() (css.TokenType, []byte) {
+	if s.peeked {
+		s.peeked = false
+		return s.tt, s.data
+	}
+	return s.l.Next()
+}
+
+func (s *tokenStream) peek() (css.TokenType, []byte) {
+	if !s.peeked {
+		s.tt, s.data = s.l.Next()
+		s.peeked = true
+	}
+	return s.tt, s.data
+}
+
+// err returns the error of the lexer, if it is not the end of the input.
+func (s *tokenStream) err() error {
+	if err := s.l.Err(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (s *tokenStream) offset() int {
+	return s.r.Offset()
+}
+
+// blockStack holds the closing tokens of the simple blocks and functions that are open in an item, the innermost last.
+// A closing token only closes the innermost block if it matches it; otherwise it is part of the item
+// (e.g., the ")" of "color: red)"), so a stray closing token does not swallow the rest of the stylesheet.
+// See https://www.w3.org/TR/css-syntax-3/#consume-simple-block
+type blockStack []css.TokenType
+
+// update opens or closes a block with a token.
+func (b *blockStack) update(tt css.TokenType) {
+	switch tt {
+	case css.LeftParenthesisToken, css.FunctionToken:
+		*b = append(*b, css.RightParenthesisToken)
+	case css.LeftBracketToken:
+		*b = append(*b, css.RightBracketToken)
+	case css.LeftBraceToken:
+		*b = append(*b, css.RightBraceToken)
+	case css.RightParenthesisToken, css.RightBracketToken, css.RightBraceToken:
+		if n := len(*b); n > 0 && (*b)[n-1] == tt {
+			*b = (*b)[:n-1]
+		}
+	}
+}
+
+// top returns whether no block is open.
+func (b blockStack) top() bool {
+	return len(b) == 0
+}
+
+// readNodes reads the items of a stylesheet (nested is false) or of a {} block (nested is true).
+// A block ends with the closing brace or the end of the input.
+func readNodes(s *tokenStream, nested bool) ([]cssNode, error) {
+	var nodes []cssNode
+	for {
+		tt, data := s.peek()
+		switch tt {
+		case css.ErrorToken:
+			// unclosed blocks are closed at the end of the input, like browsers do
+			s.next()
+			return nodes, s.err()
+		case css.WhitespaceToken, css.CommentToken, css.SemicolonToken, css.CDOToken, css.CDCToken:
+			s.next()
+		case css.RightBraceToken:
+			if !nested {
+				return nodes, fmt.Errorf("unexpected '}' at offset %d", s.offset())
+			}
+			s.next()
+			return nodes, nil
+		case css.AtKeywordToken:
+			s.next()
+			node, err := readAtRule(s, strings.ToLower(string(data)))
+			if err != nil {
+				return nodes, err
+			}
+			nodes = append(nodes, node)
+		default:
+			node, ok, err := readItem(s)
+			if err != nil {
+				return nodes, err
+			}
+			if ok {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+}
+
+// readAtRule reads the prelude and the optional block of an at-rule.
+// The at-keyword is already consumed.
+func readAtRule(s *tokenStream, name string) (cssNode, error) {
+	node := cssNode{kind: atRuleNode, name: name, offset: s.offset()}
+	var blocks blockStack
+	for {
+		tt, data := s.peek()
+		switch {
+		case tt == css.ErrorToken:
+			return node, nil
+		case blocks.top() && tt == css.SemicolonToken:
+			s.next()
+			return node, nil
+		case blocks.top() && tt == css.RightBraceToken:
+			// the closing brace belongs to the parent block
+			return node, nil
+		case blocks.top() && tt == css.LeftBraceToken:
+			s.next()
+			block, err := readNodes(s, true)
+			node.block = block
+			node.hasBlock = true
+			return node, err
+		}
+		blocks.update(tt)
+		s.next()
+		node.prelude = append(node.prelude, css.Token{TokenType: tt, Data: data})
+	}
+}
+
+// readItem reads a declaration or a qualified rule.
+// It returns false if the item is neither (e.g., a declaration without a colon).
+func readItem(s *tokenStream) (cssNode, bool, error) {
+	offset := s.offset()
+	if tt, _ := s.peek(); tt == css.CustomPropertyNameToken {
+		// custom properties can hold any value, including {} blocks, so they are never a nested rule
+		return readCustomProperty(s)
+	}
+
+	var tokens []css.Token
+	var blocks blockStack
+	for {
+		tt, data := s.peek()
+		switch {
+		case tt == css.ErrorToken,
+			blocks.top() && tt == css.SemicolonToken,
+			blocks.top() && tt == css.RightBraceToken:
+			if tt == css.SemicolonToken {
+				s.next()
+			}
+			node, ok := declaration(tokens)
+			node.offset = offset
+			return node, ok, nil
+		case blocks.top() && tt == css.LeftBraceToken:
+			s.next()
+			block, err := readNodes(s, true)
+			return cssNode{kind: qualifiedRuleNode, prelude: tokens, block: block, hasBlock: true, offset: offset}, true, err
+		}
+		blocks.update(tt)
+		s.next()
+		tokens = append(tokens, css.Token{TokenType: tt, Data: data})
+	}
+}
+
+// declaration turns the tokens of an item into a declaration: property, colon and value.
+func declaration(tokens []css.Token) (cssNode, bool) {
+	tokens = trimTokens(tokens)
+	if len(tokens) < 2 || tokens[0].TokenType != css.IdentToken {
+		return cssNode{}, false
+	}
+	i := 1
+	for i < len(tokens) && isSpace(tokens[i].TokenType) {
+		i++
+	}
+	if i == len(tokens) || tokens[i].TokenType != css.ColonToken {
+		return cssNode{}, false
+	}
+	name := strings.ToLower(string(tokens[0].Data))
+	value, important := trimImportant(tokens[i+1:])
+	return cssNode{kind: declarationNode, name: name, prelude: value, important: important}, true
+}
+
+// trimImportant removes !important from the end of a declaration value, and returns whether it was there.
+// The ! and the keyword may be separated by whitespace and comments, and the keyword is case-insensitive.
+func trimImportant(tokens []css.Token) ([]css.Token, bool) {
+	tokens = trimTokens(tokens)
+	n := len(tokens)
+	if n < 2 || tokens[n-1].TokenType != css.IdentToken || !strings.EqualFold(string(tokens[n-1].Data), "important") {
+		return tokens, false
+	}
+	i := n - 2
+	for i > 0 && isSpace(tokens[i].TokenType) {
+		i--
+	}
+	if tokens[i].TokenType != css.DelimToken || string(tokens[i].Data) != "!" {
+		return tokens, false
+	}
+	return trimTokens(tokens[:i]), true
+}
+
+// readCustomProperty reads a custom property declaration (e.g., --tw-ring-color: red).
+// The value is kept as written, so it is returned as a single CustomPropertyValueToken.
+func readCustomProperty(s *tokenStream) (cssNode, bool, error) {
+	offset := s.offset()
+	_, name := s.next()
+	node := cssNode{kind: declarationNode, name: string(name), offset: offset}
+	for {
+		tt, _ := s.peek()
+		if isSpace(tt) {
+			s.next()
+			continue
+		}
+		if tt != css.ColonToken {
+			// not a declaration, skip to the end of the item
+			_, _, err := readItem(s)
+			return node, false, err
+		}
+		s.next()
+		break
+	}
+	var tokens []css.Token
+	var blocks blockStack
+	for {
+		tt, data := s.peek()
+		if tt == css.ErrorToken || blocks.top() && (tt == css.SemicolonToken || tt == css.RightBraceToken) {
+			if tt == css.SemicolonToken {
+				s.next()
+			}
+			value := strings.Builder{}
+			tokens, node.important = trimImportant(tokens)
+			for _, t := range tokens {
+				value.Write(t.Data)
+			}
+			node.prelude = []css.Token{{TokenType: css.CustomPropertyValueToken, Data: []byte(value.String())}}
+			return node, true, nil
+		}
+		blocks.update(tt)
+		s.next()
+		tokens = append(tokens, css.Token{TokenType: tt, Data: data})
+	}
+}
+
+func isSpace(tt css.TokenType) bool {
+	return tt == css.WhitespaceToken || tt == css.CommentToken
+}
+
+// trimTokens removes leading and trailing whitespace and comments.
+func trimTokens(tokens []css.Token) []css.Token {
+	for len(tokens) > 0 && isSpace(tokens[0].TokenType) {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 0 && isSpace(tokens[len(tokens)-1].TokenType) {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// isTightDelim returns whether whitespace around the token is not significant.
+// The characters are the ones of the tdewolff css parser.
+func isTightDelim(t css.Token, chars string) bool {
+	return len(t.Data) == 1 && strings.IndexByte(chars, t.Data[0]) >= 0
+}
+
+// tokensString joins tokens into a string.
+// Whitespace and comments are collapsed into a single space,
+// and whitespace next to any of the tight characters is removed.
+// A space directly inside parentheses is also removed.
+func tokensString(tokens []css.Token, tight string) string {
+	tokens = trimTokens(tokens)
+	b := strings.Builder{}
+	for i, t := range tokens {
+		if isSpace(t.TokenType) {
+			if isSpace(tokens[i-1].TokenType) {
+				continue
+			}
+			prev := tokens[i-1]
+			next := tokens[i+1] // tokens are trimmed, so whitespace is never the last token
+			for j := i + 1; isSpace(next.TokenType); j++ {
+				next = tokens[j]
+			}
+			if isTightDelim(prev, tight) || isTightDelim(next, tight) ||
+				prev.TokenType == css.LeftParenthesisToken || prev.TokenType == css.FunctionToken ||
+				next.TokenType == css.RightParenthesisToken {
+				continue
+			}
+			b.WriteByte(' ')
+			continue
+		}
+		b.Write(t.Data)
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package cascadia
+
+import "golang.org/x/net/html"
+
+// IsDynamic returns whether a selector depends on a state that cannot be read from the document,
+// like the user-action pseudo-classes (:hover, :focus, ...) or whether a checkbox is checked.
+func IsDynamic(sel Sel) bool {
+	switch t := sel.(type) {
+	case abstractPseudoClass, HoverPseudoClassSelector, ActivePseudoClassSelector, FocusPseudoClassSelector,
+		VisitedPseudoClassSelector, TargetPseudoClassSelector, PopoverPseudoClassSelector,
+		ReadOnlyPseudoClassSelector, CheckedPseudoClassSelector:
+		return true
+	case CompoundSelector:
+		return anyDynamic(t.selectors)
+	case CombinedSelector:
+		return IsDynamic(t.first) || (t.second != nil && IsDynamic(t.second))
+	case IsPseudoClassSelector:
+		return anyDynamic(t.match)
+	case WherePseudoClassSelector:
+		return anyDynamic(t.match)
+	case RelativePseudoClassSelector:
+		return anyDynamic(t.match)
+	}
+	return false
+}
+
+func anyDynamic(selectors []Sel) bool {
+	for _, sel := range selectors {
+		if IsDynamic(sel) {
+			return true
+		}
+	}
+	return false
+}
+
+// MayMatch returns whether sel matches n in some state of the document.
+// The parts of the selector that depend on a state (see IsDynamic) are assumed to match,
+// so ".group:hover .item" may match an element with the item class in an element with the group class.
+// Pseudo-elements are ignored like they are by Match.
+func MayMatch(sel Sel, n *html.Node) bool {
+	switch t := sel.(type) {
+	case abstractPseudoClass, HoverPseudoClassSelector, ActivePseudoClassSelector, FocusPseudoClassSelector,
+		VisitedPseudoClassSelector, TargetPseudoClassSelector, PopoverPseudoClassSelector,
+		ReadOnlyPseudoClassSelector, CheckedPseudoClassSelector:
+		return n.Type == html.ElementNode
+	case CompoundSelector:
+		if len(t.selectors) == 0 {
+			return n.Type == html.ElementNode
+		}
+		for _, s := range t.selectors {
+			if !MayMatch(s, n) {
+				return false
+			}
+		}
+		return true
+	case CombinedSelector:
+		return mayMatchCombined(t, n)
+	case IsPseudoClassSelector:
+		return mayMatchAny(t.match, n)
+	case WherePseudoClassSelector:
+		return mayMatchAny(t.match, n)
+	case RelativePseudoClassSelector:
+		if n.Type != html.ElementNode {
+			return false
+		}
+		switch t.name {
+		case "not":
+			// the negation of a dynamic selector matches in the states the selector does not
+			return anyDynamic(t.match) || !t.match.Match(n)
+		case "has":
+			return hasDescendantMatch(n, mayMatcher{t.match})
+		case "haschild":
+			return hasChildMatch(n, mayMatcher{t.match})
+		}
+	}
+	return sel.Match(n)
+}
+
+func mayMatchAny(selectors []Sel, n *html.Node) bool {
+	for _, sel := range selectors {
+		if MayMatch(sel, n) {
+			return true
+		}
+	}
+	return false
+}
+
+func mayMatchCombined(t CombinedSelector, n *html.Node) bool {
+	if t.first == nil {
+		return false
+	}
+	first := mayMatcher{[]Sel{t.first}}
+	switch t.combinator {
+	case 0:
+		return MayMatch(t.first, n)
+	case ' ':
+		return descendantMatch(first, mayMatcher{[]Sel{t.second}}, n)
+	case '>':
+		return childMatch(first, mayMatcher{[]Sel{t.second}}, n)
+	case '+':
+		return siblingMatch(first, mayMatcher{[]Sel{t.second}}, true, n)
+	case '~':
+		return siblingMatch(first, mayMatcher{[]Sel{t.second}}, false, n)
+	}
+	return false
+}
+
+// mayMatcher is a Matcher that matches the elements any of its selectors may match.
+type mayMatcher struct {
+	selectors []Sel
+}
+
+func (m mayMatcher) Match(n *html.Node) bool {
+	return mayMatchAny(m.selectors, n)
+}
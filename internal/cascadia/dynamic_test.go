@@ -0,0 +1,60 @@
+package cascadia
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestMayMatch(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div class="group"><p class="a">a</p><p class="b">b</p></div><input class="c" type="checkbox">`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		selector string
+		dynamic  bool
+		want     []string // the classes of the elements that may match
+	}{
+		{selector: ".a", want: []string{"a"}},
+		{selector: ".a:hover", dynamic: true, want: []string{"a"}},
+		{selector: ".a::before", want: []string{"a"}},
+		{selector: ".group:hover .a", dynamic: true, want: []string{"a"}},
+		{selector: ".other:hover .a", dynamic: true},
+		{selector: ".group > p:focus-visible", dynamic: true, want: []string{"a", "b"}},
+		{selector: ".a:hover + .b", dynamic: true, want: []string{"b"}},
+		{selector: ".b + .a", dynamic: false},
+		{selector: ".b:is(:where(.group):hover *)", dynamic: true, want: []string{"b"}},
+		{selector: ".b:not(:hover)", dynamic: true, want: []string{"b"}},
+		{selector: "p:not(.a)", dynamic: false, want: []string{"b"}},
+		{selector: ".group:has(.a:active)", dynamic: true, want: []string{"group"}},
+		{selector: ".c:checked", dynamic: true, want: []string{"c"}},
+		{selector: ".a:first-child", want: []string{"a"}},
+		{selector: ".b:first-child"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.selector, func(t *testing.T) {
+			sel, err := ParseWithPseudoElement(tc.selector)
+			if err != nil {
+				t.Fatalf("ParseWithPseudoElement returned error: %v", err)
+			}
+			if got := IsDynamic(sel); got != tc.dynamic {
+				t.Errorf("IsDynamic returned %v, want %v", got, tc.dynamic)
+			}
+			var got []string
+			for _, n := range QueryAll(doc, mayMatcher{[]Sel{sel}}) {
+				for _, a := range n.Attr {
+					if a.Key == "class" {
+						got = append(got, a.Val)
+					}
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("MayMatch matched %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -5,27 +5,12 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"slices"
 	"strings"
 
-	"github.com/tdewolff/parse/v2"
 	"github.com/tdewolff/parse/v2/css"
 )
 
-/*
-	DeclarationGrammar: This refers to a grammar rule that matches a declaration in CSS.
-	A declaration includes a property and a value, separated by a colon (:), and ends with a semicolon (;).
-
-	EndRulesetGrammar: This likely refers to a grammar rule that matches the end of a ruleset. This would be the closing curly brace (}) of a declaration block
-
-	ErrorGrammar: This likely refers to a grammar rule that matches erroneous or unexpected input in the CSS. It could be used to handle and recover from errors in a graceful manner.
-
-	AtRuleGrammar: This refers to a grammar rule that matches at-rules in CSS. At-rules start with an at sign (@) followed by an identifier (like media, import, keyframes, etc.) and include everything up to the next semicolon (;) or the next CSS block, whichever comes first.
-
-	EndAtRuleGrammar: This likely refers to a grammar rule that matches the end of an at-rule. This could be a semicolon (;) or the end of a CSS block.
-
-	RulesetGrammar: This refers to a grammar rule that matches a ruleset in CSS. A ruleset includes a selector (or a group of selectors) followed by a declaration block (which is enclosed in curly braces {} and contains declarations).
-*/
-
 // CssRule represents a CSS rule, which includes a selector and a list of declarations.
 // It also includes a condition, which is used to represent the condition of an at-rule (e.g., @media).
 // The condition can also be a pseudo-element or pseudo-class for a compound selector (e.g., :hover, ::before).
@@ -33,27 +18,87 @@ type CssRule struct {
 	Selector     Sel              // Selector is the selector for the rule
 	Declarations []CssDeclaration // Declarations is a list of declarations for the rule (e.g., property-value pairs)
 	condition    string           // Condition is the condition for the rule (e.g., for an at-rule like @media)
+	atRules      []AtRule         // AtRules is the chain of conditional at-rules the rule is nested in, outermost first
+	layer        string           // Layer is the full name of the cascade layer the rule is in (e.g., "components" or "base.reset")
+	source       string           // Source is the name of the stylesheet the rule is from (e.g., a file name), if it has one
+}
+
+// AtRule is a conditional group rule (e.g., @media or @supports) that a CssRule is nested in.
+type AtRule struct {
+	Name      string // Name is the name of the at-rule including the @ (e.g., "@media")
+	Condition string // Condition is the prelude of the at-rule (e.g., "(min-width:640px)")
+}
+
+func (a AtRule) String() string {
+	return a.Name + " " + a.Condition
+}
+
+// joinAtRules returns the condition of a chain of nested at-rules.
+// @supports (display:grid) { @media (min-width:640px) { ... } } => "@supports (display:grid) and @media (min-width:640px)"
+func joinAtRules(atRules []AtRule) string {
+	strs := make([]string, len(atRules))
+	for i, a := range atRules {
+		strs[i] = a.String()
+	}
+	return strings.Join(strs, " and ")
 }
 
 func (r CssRule) String() string {
-	return fmt.Sprintf("Selector: %v, Declarations: %v, Condition: %v", r.Selector, r.Declarations, r.condition)
+	return fmt.Sprintf("Selector: %v, Declarations: %v, Condition: %v, Layer: %v", r.Selector, r.Declarations, r.condition, r.layer)
 }
 
 func (r CssRule) GetSelector() string {
 	return r.Selector.String()
 }
 
+// GetCondition returns the circumstance in which the rule applies.
+// It is the chain of at-rules the rule is nested in followed by the pseudo-classes of a compound selector (e.g., "@media (min-width:640px) :hover").
 func (r CssRule) GetCondition() string {
+	pseudo := ""
 	if t, ok := r.Selector.(CompoundSelector); ok {
-		return t.PseudoElementsString()
+		pseudo = t.PseudoElementsString()
+	}
+	if r.condition == "" {
+		return pseudo
 	}
+	if pseudo == "" {
+		return r.condition
+	}
+	return r.condition + " " + pseudo
+}
+
+// GetAtRuleCondition returns the condition of the chain of at-rules the rule is nested in (e.g., "@supports (display:grid) and @media (min-width:640px)").
+// It is empty if the rule is not nested in a conditional at-rule.
+func (r CssRule) GetAtRuleCondition() string {
 	return r.condition
 }
 
+// GetAtRules returns the chain of conditional at-rules the rule is nested in, outermost first.
+func (r CssRule) GetAtRules() []AtRule {
+	return r.atRules
+}
+
+// GetLayer returns the full name of the cascade layer the rule belongs to.
+// Nested layers are joined with a dot (e.g., "framework.base").
+// An empty string means the rule is not in a layer.
+func (r CssRule) GetLayer() string {
+	return r.layer
+}
+
+// GetSource returns the name of the stylesheet the rule is from (see Stylesheet.SetSource).
+// An empty string means the stylesheet has no name.
+func (r CssRule) GetSource() string {
+	return r.source
+}
+
 func (r CssRule) ToCssFormat() string {
 	dec := strings.Builder{}
 	for i, d := range r.Declarations {
-		dec.WriteString(fmt.Sprintf("%s: %s;", d.Property, d.Value))
+		dec.WriteString(fmt.Sprintf("%s: %s", d.Property, d.Value))
+		if d.Important {
+			dec.WriteString(" !important")
+		}
+		dec.WriteByte(';')
 		if i < len(r.Declarations)-1 {
 			dec.WriteByte(' ')
 		}
@@ -63,34 +108,14 @@ func (r CssRule) ToCssFormat() string {
 
 // CssDeclaration represents a CSS declaration, which includes a property and a value.
 type CssDeclaration struct {
-	Property string // Property is the property for the declaration (e.g., "color")
-	Value    string // Value is the value for the declaration (e.g., "red")
+	Property  string // Property is the property for the declaration (e.g., "color")
+	Value     string // Value is the value for the declaration, without !important (e.g., "red")
+	Important bool   // Important is true if the declaration is marked !important
 }
 
-// getSelector parses the selector from the tokens
-func getSelector(data []byte, tokens []css.Token) (Sel, error) {
-	fullSelector := strings.Builder{}
-	for _, val := range tokens {
-		fullSelector.Write(val.Data)
-	}
-	casc, err := ParseWithPseudoElement(fullSelector.String())
-	return casc, err
-}
-
-// parses the name of an at-rule and its values if it's a media query
-// @media (min-width: 600px) { /* styles */ } => "media", "(min-width: 600px)"
-func parseAtRuleName(data []byte, values []css.Token) (string, string) {
-	if string(data) != "@media" && string(data) != "@supports" {
-		return "", ""
-	}
-	if len(values) == 0 {
-		panic("no values")
-	}
-	ruleBuilder := strings.Builder{}
-	for _, val := range values {
-		ruleBuilder.Write(val.Data)
-	}
-	return string(data), ruleBuilder.String()
+// getSelectors parses the selector list of a rule (e.g., ".btn-a, .btn-b")
+func getSelectors(selector string) (SelectorGroup, error) {
+	return ParseGroupWithPseudoElements(selector)
 }
 
 func CssUnescape(b []byte) string {
@@ -127,76 +152,382 @@ func normalizeWhitespace(s string) string {
 	return strings.Join(strings.Fields(s), " ")
 }
 
-func ExtractRules(r io.Reader, inline bool) ([]CssRule, error) {
-	p := css.NewParser(parse.NewInput(r), inline)
-	rules := make([]CssRule, 0)
-	var err error
-	var currentRule CssRule
-	var atRuleCondition string
-	ignore := false
-	ruleSetErr := false
-	for {
-		gt, _, data := p.Next()
-		if ignore && gt != css.EndAtRuleGrammar {
-			continue
+// Stylesheet is the result of parsing a stylesheet.
+type Stylesheet struct {
+	Rules      []CssRule      // Rules is the list of style rules in source order
+	Layers     []string       // Layers is the list of full layer names in the order they were first declared
+	Properties []PropertyRule // Properties is the list of custom properties registered with @property
+}
+
+// SetSource sets the name of the stylesheet (e.g., a file name) on each of its rules.
+func (s *Stylesheet) SetSource(name string) {
+	for i := range s.Rules {
+		s.Rules[i].source = name
+	}
+}
+
+// RenameLayers replaces the full name of each layer declared by the stylesheet, and of the layer of each of its rules,
+// with rename(name). Unlayered rules are not renamed.
+func (s *Stylesheet) RenameLayers(rename func(name string) string) {
+	for i, layer := range s.Layers {
+		s.Layers[i] = rename(layer)
+	}
+	for i := range s.Rules {
+		if s.Rules[i].layer != "" {
+			s.Rules[i].layer = rename(s.Rules[i].layer)
 		}
+	}
+}
+
+// PropertyRule is a custom property registered with @property.
+// See https://developer.mozilla.org/en-US/docs/Web/CSS/@property
+type PropertyRule struct {
+	Name         string // Name is the name of the custom property (e.g., "--tw-rotate-x")
+	Syntax       string // Syntax is the syntax descriptor without quotes (e.g., "<length>" or "*")
+	Inherits     bool   // Inherits is true if the property inherits its value
+	InitialValue string // InitialValue is the initial value of the property (e.g., "rotateX(0)"), if any
+}
+
+// AnonymousLayerName returns the name of the nth anonymous @layer block, counting from 1.
+// Anonymous layers are numbered in the order of the stylesheet, so the names are only unique within a stylesheet
+// (see Stylesheet.RenameLayers).
+func AnonymousLayerName(n int) string {
+	return fmt.Sprintf("<anonymous-%d>", n)
+}
+
+// IsAnonymousLayer returns whether a layer name (e.g., a part of a full layer name) is the name of an anonymous @layer block.
+func IsAnonymousLayer(name string) bool {
+	return strings.HasPrefix(name, "<anonymous-")
+}
 
-		if ruleSetErr && gt != css.EndRulesetGrammar {
+// parseLayerNames parses the names in the prelude of a @layer rule.
+// @layer base, components; => "base", "components"
+// An empty slice is returned for an anonymous layer.
+func parseLayerNames(values []css.Token) []string {
+	nameBuilder := strings.Builder{}
+	for _, val := range values {
+		if isSpace(val.TokenType) {
 			continue
-		} else if ruleSetErr && gt == css.EndRulesetGrammar {
-			ruleSetErr = false
 		}
+		nameBuilder.Write(val.Data)
+	}
+	if nameBuilder.Len() == 0 {
+		return nil
+	}
+	return strings.Split(nameBuilder.String(), ",")
+}
 
-		switch gt {
-		case css.ErrorGrammar:
-			err = p.Err()
-			if err == io.EOF {
-				err = nil
+// fullLayerName prefixes a layer name with the name of the layer it is nested in.
+func fullLayerName(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// hasNesting returns whether a selector contains the nesting selector (&).
+func hasNesting(selector string) bool {
+	return replaceNesting(selector, "", "") != selector
+}
+
+// replaceNesting replaces the nesting selectors (&) in a nested selector with the selector of the parent rule.
+// A nesting selector that starts the nested selector is replaced with parent, the others with wrapped.
+// Escaped ampersands (e.g., in .\[\&\>\*\]\:underline) and ampersands in strings are left alone.
+func replaceNesting(selector string, parent string, wrapped string) string {
+	b := strings.Builder{}
+	var quote byte
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case c == '\\' && i+1 < len(selector):
+			b.WriteByte(c)
+			i++
+			c = selector[i]
+		case quote != 0:
+			if c == quote {
+				quote = 0
 			}
-			if err != nil {
-				err = fmt.Errorf("encountered error parsing CSS: %v", err)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '&' && i == 0:
+			b.WriteString(parent)
+			continue
+		case c == '&':
+			b.WriteString(wrapped)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// nestSelector resolves a nested selector against the selector of its parent rule.
+// A nested selector without a nesting selector (&) is relative to the parent:
+// .title is a descendant of the parent (& .title) and > .title keeps its combinator (& > .title).
+// The nesting selector matches the same elements as :is(parent), so a parent with combinators is wrapped in :is()
+// unless it starts the nested selector (e.g., .a .b { .c & { } } => .c :is(.a .b), but .a .b { &:hover { } } => .a .b:hover).
+func nestSelector(nested string, parent string, parentSel Sel) string {
+	if !hasNesting(nested) {
+		nested = "& " + nested
+	}
+	wrapped := parent
+	if _, ok := parentSel.(CombinedSelector); ok {
+		wrapped = ":is(" + parent + ")"
+	}
+	return replaceNesting(nested, parent, wrapped)
+}
+
+// nestSelectors resolves a nested selector list against each selector of the list of its parent rule (see nestSelector).
+// .a, .b { .c, .d { } } => .a .c, .a .d, .b .c, .b .d
+func nestSelectors(nested string, parents SelectorGroup) string {
+	var resolved []string
+	for _, parent := range parents {
+		for _, n := range splitSelectorList(nested) {
+			resolved = append(resolved, nestSelector(n, parent.String(), parent))
+		}
+	}
+	return strings.Join(resolved, ", ")
+}
+
+// splitSelectorList splits a selector list at the commas that are not in parentheses, brackets or strings
+// (e.g., ".a, :is(.b, .c)" => ".a" and ":is(.b, .c)"). Escaped commas are left alone.
+func splitSelectorList(selector string) []string {
+	var list []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
 			}
-			return rules, err
-		case css.BeginAtRuleGrammar:
-			name, condition := parseAtRuleName(data, p.Values())
-			if name == "" {
-				atRuleCondition = ""
-				ignore = true
-				continue
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			list = append(list, strings.TrimSpace(selector[start:i]))
+			start = i + 1
+		}
+	}
+	return append(list, strings.TrimSpace(selector[start:]))
+}
+
+// ExtractRules parses a stylesheet and returns the style rules it contains.
+// See ExtractStylesheet if the layer order is needed.
+func ExtractRules(r io.Reader, inline bool) ([]CssRule, error) {
+	sheet, err := ExtractStylesheet(r, inline)
+	return sheet.Rules, err
+}
+
+// ExtractStylesheet parses a stylesheet and returns its style rules and the cascade layers it declares.
+// A rule with a selector list (e.g., .btn-a, .btn-b) is returned as one rule per selector of the list, in the order of the list.
+// Rules in @media and @supports blocks keep the chain of at-rule conditions they are nested in.
+// Rules in @layer blocks keep the full name of the layer.
+// Nested rules (CSS nesting) are flattened: nested selectors are resolved against the parent selector
+// (see nestSelector) and at-rules nested in a rule are added to the condition of the rule.
+// Custom properties registered with @property are returned in Properties,
+// and the custom properties of a @theme block are returned as a :root rule.
+// Other at-rules are ignored.
+func ExtractStylesheet(r io.Reader, inline bool) (Stylesheet, error) {
+	s := newTokenStream(r)
+	nodes, err := readNodes(s, false)
+	if err != nil {
+		err = fmt.Errorf("encountered error parsing CSS: %v", err)
+	}
+	e := &extractor{sheet: Stylesheet{Rules: make([]CssRule, 0)}}
+	if !inline {
+		// an inline style attribute only has declarations and no rules
+		e.nodes(nodes)
+	}
+	return e.sheet, err
+}
+
+// extractor walks the nodes of a stylesheet and flattens them into rules.
+type extractor struct {
+	sheet     Stylesheet
+	atRules   []AtRule // the open conditional at-rules, outermost first
+	layers    []string // the full layer names of the open @layer blocks
+	anonymous int      // the number of anonymous @layer blocks so far
+}
+
+func (e *extractor) currentLayer() string {
+	if len(e.layers) == 0 {
+		return ""
+	}
+	return e.layers[len(e.layers)-1]
+}
+
+func (e *extractor) declareLayer(name string) {
+	for _, l := range e.sheet.Layers {
+		if l == name {
+			return
+		}
+	}
+	e.sheet.Layers = append(e.sheet.Layers, name)
+}
+
+// newRule creates a rule in the current at-rule condition and layer.
+func (e *extractor) newRule(sel Sel) CssRule {
+	rule := CssRule{Selector: sel, layer: e.currentLayer()}
+	if len(e.atRules) > 0 {
+		rule.atRules = slices.Clone(e.atRules)
+		rule.condition = joinAtRules(e.atRules)
+	}
+	return rule
+}
+
+// nodes extracts the rules of a stylesheet or of an at-rule block that is not nested in a rule.
+func (e *extractor) nodes(nodes []cssNode) {
+	for _, n := range nodes {
+		switch n.kind {
+		case qualifiedRuleNode:
+			e.styleRule(tokensString(n.prelude, ",>+~"), n.block)
+		case atRuleNode:
+			e.atRule(n, "")
+		}
+	}
+}
+
+// atRule extracts the rules of an at-rule.
+// parent is the selector of the rule the at-rule is nested in, or empty if it is not nested in a rule.
+func (e *extractor) atRule(n cssNode, parent string) {
+	// block is the function that extracts the contents of a conditional or layer block
+	block := func() {
+		if parent == "" {
+			e.nodes(n.block)
+		} else {
+			// declarations in an at-rule nested in a rule apply to the parent selector
+			e.styleRule(parent, n.block)
+		}
+	}
+
+	switch n.name {
+	case "@layer":
+		if !n.hasBlock {
+			// @layer base, components; only declares the order of the layers
+			for _, name := range parseLayerNames(n.prelude) {
+				e.declareLayer(fullLayerName(e.currentLayer(), name))
 			}
-			atRuleCondition = condition
-		case css.EndAtRuleGrammar:
-			atRuleCondition = ""
-			ignore = false
-		case css.BeginRulesetGrammar:
-			currentRule = CssRule{}
-			currentRule.condition = atRuleCondition
-			sel, err := getSelector(data, p.Values())
-			if err != nil {
-				log.Println("error parsing rule:", err) // TODO: LOG this better
-				ruleSetErr = true
-				currentRule = CssRule{}
-				continue
+			return
+		}
+		var name string
+		if names := parseLayerNames(n.prelude); len(names) > 0 {
+			name = names[0]
+		} else {
+			e.anonymous++
+			name = AnonymousLayerName(e.anonymous)
+		}
+		// @layer a.b { } declares a and a.b
+		full := e.currentLayer()
+		for _, part := range strings.Split(name, ".") {
+			full = fullLayerName(full, part)
+			e.declareLayer(full)
+		}
+		e.layers = append(e.layers, full)
+		block()
+		e.layers = e.layers[:len(e.layers)-1]
+	case "@media", "@supports":
+		if !n.hasBlock {
+			return
+		}
+		e.atRules = append(e.atRules, AtRule{Name: n.name, Condition: tokensString(n.prelude, ",:")})
+		block()
+		e.atRules = e.atRules[:len(e.atRules)-1]
+	case "@property":
+		if parent == "" && n.hasBlock {
+			e.property(n)
+		}
+	case "@theme":
+		// tailwind compiles the theme variables to a :root rule
+		if parent == "" && n.hasBlock {
+			e.styleRule(":root", n.block)
+		}
+	}
+}
+
+// property extracts a custom property registration.
+// @property --tw-rotate-x { syntax: "*"; inherits: false; initial-value: rotateX(0); }
+func (e *extractor) property(n cssNode) {
+	prop := PropertyRule{Name: tokensString(n.prelude, "")}
+	for _, d := range n.block {
+		if d.kind != declarationNode {
+			continue
+		}
+		dec := buildDeclaration(d)
+		switch dec.Property {
+		case "syntax":
+			prop.Syntax = strings.Trim(dec.Value, `"'`)
+		case "inherits":
+			prop.Inherits = dec.Value == "true"
+		case "initial-value":
+			prop.InitialValue = dec.Value
+		}
+	}
+	e.sheet.Properties = append(e.sheet.Properties, prop)
+}
+
+// styleRule extracts a rule and the rules nested in it.
+// A rule with a selector list (e.g., .btn-a, .btn-b) is extracted as one rule per selector, in the order of the list.
+// Declarations are grouped into rules with the selector of the rule, in order with the nested rules:
+// declarations after a nested rule are added as new rules after the nested rules, like browsers do.
+func (e *extractor) styleRule(selector string, block []cssNode) {
+	group, err := getSelectors(selector)
+	if err != nil {
+		log.Println("error parsing rule:", err) // TODO: LOG this better
+		return
+	}
+	rules := e.newRules(group)
+	empty := true
+	for _, n := range block {
+		if n.kind == declarationNode {
+			dec := buildDeclaration(n)
+			for i := range rules {
+				rules[i].Declarations = append(rules[i].Declarations, dec)
 			}
-			currentRule.Selector = sel
-		case css.DeclarationGrammar:
-			declaration := buildDeclaration(p, data)
-			currentRule.Declarations = append(currentRule.Declarations, declaration)
-		case css.EndRulesetGrammar:
-			rules = append(rules, currentRule)
-		case css.CustomPropertyGrammar:
-			declaration := buildDeclaration(p, data)
-			currentRule.Declarations = append(currentRule.Declarations, declaration)
+			continue
+		}
+		if len(rules[0].Declarations) > 0 {
+			e.sheet.Rules = append(e.sheet.Rules, rules...)
+			rules = e.newRules(group)
+			empty = false
 		}
+		switch n.kind {
+		case qualifiedRuleNode:
+			e.styleRule(nestSelectors(tokensString(n.prelude, ",>+~"), group), n.block)
+			empty = false
+		case atRuleNode:
+			e.atRule(n, selector)
+			empty = false
+		}
+	}
+	if len(rules[0].Declarations) > 0 || empty {
+		e.sheet.Rules = append(e.sheet.Rules, rules...)
+	}
+}
+
+// newRules creates a rule for each selector of a list in the current at-rule condition and layer.
+func (e *extractor) newRules(group SelectorGroup) []CssRule {
+	rules := make([]CssRule, len(group))
+	for i, sel := range group {
+		rules[i] = e.newRule(sel)
 	}
+	return rules
 }
 
-func buildDeclaration(p *css.Parser, data []byte) CssDeclaration {
-	vals := strings.Builder{}
-	for _, val := range p.Values() {
-		vals.Write(val.Data)
+func buildDeclaration(n cssNode) CssDeclaration {
+	var s string
+	if len(n.prelude) == 1 && n.prelude[0].TokenType == css.CustomPropertyValueToken {
+		// custom properties are kept as written
+		s = normalizeWhitespace(string(n.prelude[0].Data))
+	} else {
+		s = tokensString(n.prelude, ",/:!=")
 	}
-	s := normalizeWhitespace(vals.String())
-	declaration := CssDeclaration{Property: string(data), Value: CssUnescape([]byte(s))}
+	declaration := CssDeclaration{Property: n.name, Value: CssUnescape([]byte(s)), Important: n.important}
 	return declaration
 }
@@ -48,7 +48,7 @@ func TestExtractRulesFile2(t *testing.T) {
 		{
 			Selector:     ClassSelector{Class: "sm:grid-cols-2"},
 			Declarations: []CssDeclaration{{Property: "grid-template-columns", Value: "repeat(2,minmax(0,1fr))"}},
-			condition:    "(min-width:640px)",
+			condition:    "@media (min-width:640px)",
 		},
 		{
 			Selector:     IdSelector{id: "test"},
@@ -98,3 +98,600 @@ func TestExtractRulesFile2(t *testing.T) {
 		}
 	})
 }
+
+func TestExtractStylesheetLayers(t *testing.T) {
+	input := `
+	@layer reset, components;
+
+	@layer components {
+		.btn {
+			padding: 1rem;
+		}
+		@layer variants {
+			.btn-sm {
+				padding: 0.5rem;
+			}
+		}
+	}
+
+	@layer reset.base {
+		.p-0 {
+			padding: 0;
+		}
+	}
+
+	@media (min-width: 640px) {
+		@layer utilities {
+			.sm\:p-2 {
+				padding: 0.5rem;
+			}
+		}
+	}
+
+	.p-1 {
+		padding: 0.25rem;
+	}
+	`
+
+	wantLayers := []string{"reset", "components", "components.variants", "reset.base", "utilities"}
+	want := []struct {
+		class     string
+		layer     string
+		condition string
+	}{
+		{class: "btn", layer: "components"},
+		{class: "btn-sm", layer: "components.variants"},
+		{class: "p-0", layer: "reset.base"},
+		{class: "sm:p-2", layer: "utilities", condition: "@media (min-width:640px)"},
+		{class: "p-1", layer: ""},
+	}
+
+	sheet, err := ExtractStylesheet(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractStylesheet returned error: %v", err)
+	}
+	if !reflect.DeepEqual(sheet.Layers, wantLayers) {
+		t.Errorf("ExtractStylesheet returned layers %v, want %v", sheet.Layers, wantLayers)
+	}
+	if len(sheet.Rules) != len(want) {
+		t.Fatalf("ExtractStylesheet returned %d rules, want %d", len(sheet.Rules), len(want))
+	}
+	for i, w := range want {
+		got := sheet.Rules[i]
+		if got.Selector.String() != (ClassSelector{Class: w.class}).String() {
+			t.Errorf("rule %d: got selector %v, want .%s", i, got.Selector, w.class)
+		}
+		if got.GetLayer() != w.layer {
+			t.Errorf("rule %d: got layer %q, want %q", i, got.GetLayer(), w.layer)
+		}
+		if got.condition != w.condition {
+			t.Errorf("rule %d: got condition %q, want %q", i, got.condition, w.condition)
+		}
+	}
+}
+
+func TestExtractStylesheetAnonymousLayers(t *testing.T) {
+	input := `
+	@layer {
+		.a {
+			color: red;
+		}
+	}
+	@layer {
+		.b {
+			color: blue;
+		}
+	}
+	`
+	sheet, err := ExtractStylesheet(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractStylesheet returned error: %v", err)
+	}
+	if len(sheet.Layers) != 2 || len(sheet.Rules) != 2 {
+		t.Fatalf("ExtractStylesheet returned %d layers and %d rules, want 2 and 2", len(sheet.Layers), len(sheet.Rules))
+	}
+	if sheet.Layers[0] == sheet.Layers[1] {
+		t.Errorf("anonymous layers share the name %q", sheet.Layers[0])
+	}
+	for i, rule := range sheet.Rules {
+		if rule.GetLayer() != sheet.Layers[i] {
+			t.Errorf("rule %d: got layer %q, want %q", i, rule.GetLayer(), sheet.Layers[i])
+		}
+	}
+
+	// the names are numbered in the order of the stylesheet, whatever was parsed before
+	again, err := ExtractStylesheet(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractStylesheet returned error: %v", err)
+	}
+	if !reflect.DeepEqual(again.Layers, sheet.Layers) || sheet.Layers[0] != AnonymousLayerName(1) {
+		t.Errorf("got layers %q and %q, want %q twice", sheet.Layers, again.Layers, []string{AnonymousLayerName(1), AnonymousLayerName(2)})
+	}
+
+	sheet.RenameLayers(func(name string) string { return "x." + name })
+	if sheet.Layers[1] != "x."+AnonymousLayerName(2) || sheet.Rules[1].GetLayer() != sheet.Layers[1] {
+		t.Errorf("RenameLayers: got layers %q and rule layer %q", sheet.Layers, sheet.Rules[1].GetLayer())
+	}
+}
+
+func TestExtractRulesNestedConditions(t *testing.T) {
+	input := `
+	@supports (display: grid) {
+		@media (min-width: 640px) {
+			.a {
+				display: grid;
+			}
+		}
+		.b {
+			display: grid;
+		}
+		@font-face {
+			font-family: "Test";
+		}
+		.c {
+			display: grid;
+		}
+	}
+	.d {
+		display: block;
+	}
+	`
+
+	want := []struct {
+		class     string
+		condition string
+		atRules   []AtRule
+	}{
+		{
+			class:     "a",
+			condition: "@supports (display:grid) and @media (min-width:640px)",
+			atRules:   []AtRule{{Name: "@supports", Condition: "(display:grid)"}, {Name: "@media", Condition: "(min-width:640px)"}},
+		},
+		{
+			class:     "b",
+			condition: "@supports (display:grid)",
+			atRules:   []AtRule{{Name: "@supports", Condition: "(display:grid)"}},
+		},
+		{
+			class:     "c",
+			condition: "@supports (display:grid)",
+			atRules:   []AtRule{{Name: "@supports", Condition: "(display:grid)"}},
+		},
+		{
+			class: "d",
+		},
+	}
+
+	got, err := ExtractRules(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractRules returned error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ExtractRules returned %d rules, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].Selector.String() != (ClassSelector{Class: w.class}).String() {
+			t.Errorf("rule %d: got selector %v, want .%s", i, got[i].Selector, w.class)
+		}
+		if got[i].GetAtRuleCondition() != w.condition {
+			t.Errorf("rule %d: got condition %q, want %q", i, got[i].GetAtRuleCondition(), w.condition)
+		}
+		if !reflect.DeepEqual(got[i].GetAtRules(), w.atRules) {
+			t.Errorf("rule %d: got at-rules %v, want %v", i, got[i].GetAtRules(), w.atRules)
+		}
+	}
+}
+
+func TestExtractStylesheetTailwindV4(t *testing.T) {
+	input := `
+	@layer theme, base, components, utilities;
+	@layer theme {
+		:root {
+			--spacing: 0.25rem;
+		}
+	}
+	@theme {
+		--color-brand: #3b82f6;
+	}
+	@layer utilities {
+		.p-4 {
+			padding: calc(var(--spacing) * 4);
+		}
+		.hover\:bg-red-500 {
+			&:hover {
+				@media (hover: hover) {
+					background-color: var(--color-red-500);
+				}
+			}
+		}
+		.lg\:flex {
+			@media (width >= 64rem) {
+				display: flex;
+			}
+		}
+		.group-hover\:underline {
+			&:is(:where(.group):hover *) {
+				text-decoration-line: underline;
+			}
+		}
+		.rotate-x-12 {
+			--tw-rotate-x: rotateX(12deg);
+			transform: var(--tw-rotate-x) var(--tw-rotate-y);
+		}
+	}
+	@property --tw-rotate-x {
+		syntax: "*";
+		inherits: false;
+		initial-value: rotateX(0);
+	}
+	@property --tw-shadow-color {
+		syntax: "*";
+		inherits: false;
+	}
+	`
+
+	want := []struct {
+		selector     string
+		condition    string
+		layer        string
+		declarations []CssDeclaration
+	}{
+		{
+			selector:     ":root",
+			layer:        "theme",
+			declarations: []CssDeclaration{{Property: "--spacing", Value: "0.25rem"}},
+		},
+		{
+			selector:     ":root",
+			declarations: []CssDeclaration{{Property: "--color-brand", Value: "#3b82f6"}},
+		},
+		{
+			selector:     ".p-4",
+			layer:        "utilities",
+			declarations: []CssDeclaration{{Property: "padding", Value: "calc(var(--spacing) * 4)"}},
+		},
+		{
+			selector:     ".hover\\:bg-red-500:hover",
+			condition:    "@media (hover:hover)",
+			layer:        "utilities",
+			declarations: []CssDeclaration{{Property: "background-color", Value: "var(--color-red-500)"}},
+		},
+		{
+			selector:     ".lg\\:flex",
+			condition:    "@media (width >= 64rem)",
+			layer:        "utilities",
+			declarations: []CssDeclaration{{Property: "display", Value: "flex"}},
+		},
+		{
+			selector:     ".group-hover\\:underline:is(:where(.group):hover *)",
+			layer:        "utilities",
+			declarations: []CssDeclaration{{Property: "text-decoration-line", Value: "underline"}},
+		},
+		{
+			selector: ".rotate-x-12",
+			layer:    "utilities",
+			declarations: []CssDeclaration{
+				{Property: "--tw-rotate-x", Value: "rotateX(12deg)"},
+				{Property: "transform", Value: "var(--tw-rotate-x) var(--tw-rotate-y)"},
+			},
+		},
+	}
+
+	sheet, err := ExtractStylesheet(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractStylesheet returned error: %v", err)
+	}
+	if len(sheet.Rules) != len(want) {
+		t.Fatalf("ExtractStylesheet returned %d rules, want %d: %v", len(sheet.Rules), len(want), sheet.Rules)
+	}
+	for i, w := range want {
+		got := sheet.Rules[i]
+		sel, err := ParseWithPseudoElement(w.selector)
+		if err != nil {
+			t.Fatalf("rule %d: invalid selector %q: %v", i, w.selector, err)
+		}
+		if got.Selector.String() != sel.String() {
+			t.Errorf("rule %d: got selector %v, want %v", i, got.Selector, sel)
+		}
+		if got.GetAtRuleCondition() != w.condition {
+			t.Errorf("rule %d: got condition %q, want %q", i, got.GetAtRuleCondition(), w.condition)
+		}
+		if got.GetLayer() != w.layer {
+			t.Errorf("rule %d: got layer %q, want %q", i, got.GetLayer(), w.layer)
+		}
+		if !reflect.DeepEqual(got.Declarations, w.declarations) {
+			t.Errorf("rule %d: got declarations %v, want %v", i, got.Declarations, w.declarations)
+		}
+	}
+
+	wantLayers := []string{"theme", "base", "components", "utilities"}
+	if !reflect.DeepEqual(sheet.Layers, wantLayers) {
+		t.Errorf("got layers %v, want %v", sheet.Layers, wantLayers)
+	}
+
+	wantProperties := []PropertyRule{
+		{Name: "--tw-rotate-x", Syntax: "*", InitialValue: "rotateX(0)"},
+		{Name: "--tw-shadow-color", Syntax: "*"},
+	}
+	if !reflect.DeepEqual(sheet.Properties, wantProperties) {
+		t.Errorf("got properties %v, want %v", sheet.Properties, wantProperties)
+	}
+}
+
+func TestExtractRulesNesting(t *testing.T) {
+	input := `
+	.card {
+		padding: 1rem;
+		&:hover {
+			color: red;
+		}
+		.title {
+			font-weight: bold;
+		}
+		> .icon {
+			width: 1rem;
+		}
+		.dark & {
+			color: white;
+		}
+		@media (min-width: 640px) {
+			padding: 2rem;
+			.title {
+				font-size: 2rem;
+			}
+		}
+		margin: 0;
+	}
+	.list .item {
+		&.active {
+			color: blue;
+		}
+		.dark & {
+			color: white;
+		}
+	}
+	`
+
+	want := []struct {
+		selector     string
+		condition    string
+		declarations []CssDeclaration
+	}{
+		{selector: ".card", declarations: []CssDeclaration{{Property: "padding", Value: "1rem"}}},
+		{selector: ".card:hover", declarations: []CssDeclaration{{Property: "color", Value: "red"}}},
+		{selector: ".card .title", declarations: []CssDeclaration{{Property: "font-weight", Value: "bold"}}},
+		{selector: ".card > .icon", declarations: []CssDeclaration{{Property: "width", Value: "1rem"}}},
+		{selector: ".dark .card", declarations: []CssDeclaration{{Property: "color", Value: "white"}}},
+		{selector: ".card", condition: "@media (min-width:640px)", declarations: []CssDeclaration{{Property: "padding", Value: "2rem"}}},
+		{selector: ".card .title", condition: "@media (min-width:640px)", declarations: []CssDeclaration{{Property: "font-size", Value: "2rem"}}},
+		{selector: ".card", declarations: []CssDeclaration{{Property: "margin", Value: "0"}}},
+		{selector: ".list .item.active", declarations: []CssDeclaration{{Property: "color", Value: "blue"}}},
+		{selector: ".dark :is(.list .item)", declarations: []CssDeclaration{{Property: "color", Value: "white"}}},
+	}
+
+	got, err := ExtractRules(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractRules returned error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ExtractRules returned %d rules, want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		sel, err := ParseWithPseudoElement(w.selector)
+		if err != nil {
+			t.Fatalf("rule %d: invalid selector %q: %v", i, w.selector, err)
+		}
+		if got[i].Selector.String() != sel.String() {
+			t.Errorf("rule %d: got selector %v, want %v", i, got[i].Selector, sel)
+		}
+		if got[i].GetAtRuleCondition() != w.condition {
+			t.Errorf("rule %d: got condition %q, want %q", i, got[i].GetAtRuleCondition(), w.condition)
+		}
+		if !reflect.DeepEqual(got[i].Declarations, w.declarations) {
+			t.Errorf("rule %d: got declarations %v, want %v", i, got[i].Declarations, w.declarations)
+		}
+	}
+}
+
+func TestNestSelector(t *testing.T) {
+	tt := []struct {
+		nested string
+		parent string
+		want   string
+	}{
+		{nested: "&:hover", parent: ".a", want: ".a:hover"},
+		{nested: ".b", parent: ".a", want: ".a .b"},
+		{nested: ">.b", parent: ".a", want: ".a >.b"},
+		{nested: ".b &", parent: ".a", want: ".b .a"},
+		{nested: "&+&", parent: ".a .b", want: ".a .b+:is(.a .b)"},
+		{nested: `.\[\&\>\*\]\:x`, parent: ".a", want: `.a .\[\&\>\*\]\:x`},
+		{nested: `[data-x="&"]&`, parent: ".a", want: `[data-x="&"].a`},
+	}
+	for _, tc := range tt {
+		t.Run(tc.nested, func(t *testing.T) {
+			sel, err := ParseWithPseudoElement(tc.parent)
+			if err != nil {
+				t.Fatalf("invalid parent %q: %v", tc.parent, err)
+			}
+			got := nestSelector(tc.nested, tc.parent, sel)
+			if got != tc.want {
+				t.Errorf("nestSelector(%q, %q) = %q, want %q", tc.nested, tc.parent, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractRulesSelectorLists(t *testing.T) {
+	input := `
+	.btn-a, .btn-b {
+		padding: 1rem;
+		&:hover, &:focus {
+			color: red;
+		}
+		margin: 0;
+	}
+	@media (min-width: 640px) {
+		.placeholder\:x::-moz-placeholder, .placeholder\:x::placeholder {
+			color: gray;
+		}
+	}
+	.list, :is(.a, .b) > .item {
+		.title, > .icon {
+			width: 1rem;
+		}
+	}
+	`
+
+	want := []struct {
+		selector     string
+		condition    string
+		declarations []CssDeclaration
+	}{
+		{selector: ".btn-a", declarations: []CssDeclaration{{Property: "padding", Value: "1rem"}}},
+		{selector: ".btn-b", declarations: []CssDeclaration{{Property: "padding", Value: "1rem"}}},
+		{selector: ".btn-a:hover", declarations: []CssDeclaration{{Property: "color", Value: "red"}}},
+		{selector: ".btn-a:focus", declarations: []CssDeclaration{{Property: "color", Value: "red"}}},
+		{selector: ".btn-b:hover", declarations: []CssDeclaration{{Property: "color", Value: "red"}}},
+		{selector: ".btn-b:focus", declarations: []CssDeclaration{{Property: "color", Value: "red"}}},
+		{selector: ".btn-a", declarations: []CssDeclaration{{Property: "margin", Value: "0"}}},
+		{selector: ".btn-b", declarations: []CssDeclaration{{Property: "margin", Value: "0"}}},
+		{selector: `.placeholder\:x::-moz-placeholder`, condition: "@media (min-width:640px)", declarations: []CssDeclaration{{Property: "color", Value: "gray"}}},
+		{selector: `.placeholder\:x::placeholder`, condition: "@media (min-width:640px)", declarations: []CssDeclaration{{Property: "color", Value: "gray"}}},
+		{selector: ".list .title", declarations: []CssDeclaration{{Property: "width", Value: "1rem"}}},
+		{selector: ".list > .icon", declarations: []CssDeclaration{{Property: "width", Value: "1rem"}}},
+		{selector: ":is(.a, .b) > .item .title", declarations: []CssDeclaration{{Property: "width", Value: "1rem"}}},
+		{selector: ":is(.a, .b) > .item > .icon", declarations: []CssDeclaration{{Property: "width", Value: "1rem"}}},
+	}
+
+	got, err := ExtractRules(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractRules returned error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ExtractRules returned %d rules, want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		sel, err := ParseWithPseudoElement(w.selector)
+		if err != nil {
+			t.Fatalf("rule %d: invalid selector %q: %v", i, w.selector, err)
+		}
+		if got[i].Selector.String() != sel.String() {
+			t.Errorf("rule %d: got selector %v, want %v", i, got[i].Selector, sel)
+		}
+		if got[i].GetAtRuleCondition() != w.condition {
+			t.Errorf("rule %d: got condition %q, want %q", i, got[i].GetAtRuleCondition(), w.condition)
+		}
+		if !reflect.DeepEqual(got[i].Declarations, w.declarations) {
+			t.Errorf("rule %d: got declarations %v, want %v", i, got[i].Declarations, w.declarations)
+		}
+	}
+}
+
+func TestSplitSelectorList(t *testing.T) {
+	tt := []struct {
+		in   string
+		want []string
+	}{
+		{in: ".a", want: []string{".a"}},
+		{in: ".a, .b", want: []string{".a", ".b"}},
+		{in: ".a,> .b", want: []string{".a", "> .b"}},
+		{in: ":is(.a, .b), .c", want: []string{":is(.a, .b)", ".c"}},
+		{in: `[data-x="a,b"], .c`, want: []string{`[data-x="a,b"]`, ".c"}},
+		{in: `.a\,b, .c`, want: []string{`.a\,b`, ".c"}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			if got := splitSelectorList(tc.in); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("splitSelectorList(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractRulesImportant(t *testing.T) {
+	input := `
+	.a {
+		padding: 1rem !important;
+		margin: 0!important;
+		color: red ! IMPORTANT;
+		width: calc(1rem + 2px) /* note */ ! /* note */ important;
+		content: "!important";
+		height: 1rem;
+		--tw-ring-color: rgb(0 0 0 / 0.5) !important;
+		--tw-text: "!important";
+	}
+	`
+
+	want := []CssDeclaration{
+		{Property: "padding", Value: "1rem", Important: true},
+		{Property: "margin", Value: "0", Important: true},
+		{Property: "color", Value: "red", Important: true},
+		{Property: "width", Value: "calc(1rem + 2px)", Important: true},
+		{Property: "content", Value: `"!important"`},
+		{Property: "height", Value: "1rem"},
+		{Property: "--tw-ring-color", Value: "rgb(0 0 0 / 0.5)", Important: true},
+		{Property: "--tw-text", Value: `"!important"`},
+	}
+
+	got, err := ExtractRules(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractRules returned error: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("ExtractRules returned %d rules, want 1: %v", len(got), got)
+	}
+	if !reflect.DeepEqual(got[0].Declarations, want) {
+		t.Errorf("got declarations %v, want %v", got[0].Declarations, want)
+	}
+
+	wantCss := `.a { padding: 1rem !important; margin: 0 !important; color: red !important; width: calc(1rem + 2px) !important; content: "!important"; height: 1rem; --tw-ring-color: rgb(0 0 0 / 0.5) !important; --tw-text: "!important"; }`
+	if css := got[0].ToCssFormat(); css != wantCss {
+		t.Errorf("ToCssFormat returned %q, want %q", css, wantCss)
+	}
+}
+
+func TestExtractRulesUnmatchedClosers(t *testing.T) {
+	// a closing token that does not match an open block is part of the value, and does not end the block early or late
+	input := `
+	.a { color: red) }
+	.b { color: blue }
+	.c { width: calc(1px ] + 2px); height: 1px }
+	@media (min-width: 640px)) {
+		.d { color: red; }
+	}
+	.e { --x: a ] b); color: green }
+	.f { color: red }
+	`
+
+	want := []struct {
+		selector     string
+		condition    string
+		declarations []CssDeclaration
+	}{
+		{selector: ".a", declarations: []CssDeclaration{{Property: "color", Value: "red)"}}},
+		{selector: ".b", declarations: []CssDeclaration{{Property: "color", Value: "blue"}}},
+		{selector: ".c", declarations: []CssDeclaration{{Property: "width", Value: "calc(1px ] + 2px)"}, {Property: "height", Value: "1px"}}},
+		{selector: ".d", condition: "@media (min-width:640px))", declarations: []CssDeclaration{{Property: "color", Value: "red"}}},
+		{selector: ".e", declarations: []CssDeclaration{{Property: "--x", Value: "a ] b)"}, {Property: "color", Value: "green"}}},
+		{selector: ".f", declarations: []CssDeclaration{{Property: "color", Value: "red"}}},
+	}
+
+	got, err := ExtractRules(bytes.NewBufferString(input), false)
+	if err != nil {
+		t.Fatalf("ExtractRules returned error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ExtractRules returned %d rules, want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Selector.String() != w.selector {
+			t.Errorf("rule %d: got selector %v, want %v", i, got[i].Selector, w.selector)
+		}
+		if got[i].GetAtRuleCondition() != w.condition {
+			t.Errorf("rule %d: got condition %q, want %q", i, got[i].GetAtRuleCondition(), w.condition)
+		}
+		if !reflect.DeepEqual(got[i].Declarations, w.declarations) {
+			t.Errorf("rule %d: got declarations %v, want %v", i, got[i].Declarations, w.declarations)
+		}
+	}
+}
@@ -484,6 +484,12 @@ func (c CombinedSelector) Second() Sel {
 	return c.second
 }
 
+// Combinator returns the combinator between the two selectors: ' ' (descendant), '>' (child),
+// '+' (next sibling) or '~' (subsequent sibling). It is 0 if there is no second selector.
+func (c CombinedSelector) Combinator() byte {
+	return c.combinator
+}
+
 // matches an element if it matches d and has an ancestor that matches a.
 func descendantMatch(a, d Matcher, n *html.Node) bool {
 	if !d.Match(n) {
@@ -0,0 +1,56 @@
+// Package classlist joins class values (strings, slices and maps of conditional classes) into a class list.
+// It is shared by the template functions and the templ helpers, which accept the same values.
+package classlist
+
+import (
+	"slices"
+	"strings"
+)
+
+// Other appends the classes of a value of a type that Append does not know to classes.
+type Other func(classes []string, value any) ([]string, error)
+
+// Append appends the classes of value to classes. The value can be:
+//   - a string of space-separated classes
+//   - a []string of strings of classes
+//   - a []any of values
+//   - a map[string]bool of conditional classes: a key is added if its value is true. Keys are added in alphabetical order.
+//   - nil, which is skipped
+//
+// A value of another type, including an element of a []any, is passed to other.
+func Append(classes []string, value any, other Other) ([]string, error) {
+	switch t := value.(type) {
+	case nil:
+		return classes, nil
+	case string:
+		return append(classes, strings.Fields(t)...), nil
+	case []string:
+		for _, s := range t {
+			classes = append(classes, strings.Fields(s)...)
+		}
+		return classes, nil
+	case []any:
+		for _, v := range t {
+			var err error
+			classes, err = Append(classes, v, other)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return classes, nil
+	case map[string]bool:
+		keys := make([]string, 0, len(t))
+		for k, ok := range t {
+			if ok {
+				keys = append(keys, k)
+			}
+		}
+		// the keys are sorted so the order is stable
+		slices.Sort(keys)
+		for _, k := range keys {
+			classes = append(classes, strings.Fields(k)...)
+		}
+		return classes, nil
+	}
+	return other(classes, value)
+}
@@ -0,0 +1,44 @@
+package classlist
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	t.Parallel()
+	other := func(classes []string, value any) ([]string, error) {
+		if n, ok := value.(int); ok {
+			return append(classes, fmt.Sprintf("n-%d", n)), nil
+		}
+		return nil, errors.New("unsupported")
+	}
+	tt := []struct {
+		name  string
+		value any
+		want  []string
+	}{
+		{name: "nil", value: nil, want: []string{"a"}},
+		{name: "string", value: " p-1  p-2 ", want: []string{"a", "p-1", "p-2"}},
+		{name: "strings", value: []string{"p-1 p-2", "", "m-1"}, want: []string{"a", "p-1", "p-2", "m-1"}},
+		{name: "map", value: map[string]bool{"p-2": true, "p-1": true, "m-1": false}, want: []string{"a", "p-1", "p-2"}},
+		{name: "nested", value: []any{"p-1", nil, []any{[]string{"p-2"}, 3}}, want: []string{"a", "p-1", "p-2", "n-3"}},
+		{name: "other", value: 1, want: []string{"a", "n-1"}},
+	}
+	for _, tc := range tt {
+		got, err := Append([]string{"a"}, tc.value, other)
+		if err != nil {
+			t.Errorf("%s: Append returned error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Append returned %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := Append(nil, []any{"p-1", 1.5}, other); err == nil {
+		t.Error("Append returned no error for a value that other does not support")
+	}
+}
@@ -0,0 +1,896 @@
+// Package media parses media query lists (the prelude of @media) into a normal form,
+// so queries that are written differently but match the same media can be compared.
+//
+// See https://www.w3.org/TR/mediaqueries-4/
+package media
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+)
+
+// List is a media query list in a normal form. It matches if any of its queries matches, so an empty list matches nothing.
+//
+// The queries of a normal list are sorted, and a query that implies another query of the list is left out
+// (e.g., "(min-width: 640px), (min-width: 768px)" is "(width >= 640px)").
+type List []Query
+
+// Query is a media query in a normal form: a media type and the features it requires.
+//
+// A condition with "or" or "not" is expanded into several queries of a List
+// (e.g., "not all and (min-width: 640px)" is "(width < 640px)"), so only a query with a media type can be negated.
+type Query struct {
+	Not      bool      // Not negates the whole query (e.g., "not print")
+	Type     string    // Type is the media type in lower case (e.g., "screen"), "all" if the query has none
+	Features []Feature // Features all have to match, sorted
+}
+
+// Feature is a media feature a query requires.
+type Feature struct {
+	Name  string // Name is the name of the feature in lower case, without a min- or max- prefix (e.g., "width" or "orientation")
+	Value string // Value is the value of a discrete feature (e.g., "portrait"), empty for a boolean feature (e.g., "(hover)")
+	Not   bool   // Not negates a discrete feature
+	Range Range  // Range are the values a range feature (e.g., "width") can have
+
+	kind valueKind
+}
+
+// Range is an interval of the values of a range feature.
+// Lengths are in px (1em and 1rem are 16px in a media query), resolutions in dppx,
+// and aspect ratios and integers are numbers. A missing bound is infinite.
+type Range struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+// valueKind is the kind of the values of a feature.
+type valueKind int
+
+const (
+	discrete valueKind = iota
+	length
+	resolution
+	ratio
+	integer
+)
+
+// rangeFeatures are the features that are compared with ranges, and min- and max- prefixes.
+var rangeFeatures = map[string]valueKind{
+	"width":               length,
+	"height":              length,
+	"device-width":        length,
+	"device-height":       length,
+	"aspect-ratio":        ratio,
+	"device-aspect-ratio": ratio,
+	"resolution":          resolution,
+	"color":               integer,
+	"color-index":         integer,
+	"monochrome":          integer,
+}
+
+// maxQueries limits the number of queries a condition is expanded into.
+const maxQueries = 64
+
+// Parse parses a media query list into its normal form.
+// An empty list matches all media, like @media without a condition.
+// It returns an error for queries it cannot represent in a normal form
+// (e.g., unknown units, functions like calc() or a negated type with "or").
+func Parse(s string) (List, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return List{{Type: "all"}}, nil
+	}
+	var list List
+	start := 0
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && tokens[i].tt != css.CommaToken {
+			continue
+		}
+		queries, err := parseQuery(tokens[start:i])
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, queries...)
+		if len(list) > maxQueries {
+			return nil, fmt.Errorf("media query %q has too many conditions", s)
+		}
+		start = i + 1
+	}
+	return list.normalize(), nil
+}
+
+// Implies returns whether every medium that matches l matches o.
+// It is sound but not complete: it can return false for lists that do imply each other
+// in ways the normal form does not capture (e.g., with features it does not know).
+func (l List) Implies(o List) bool {
+	for _, q := range l {
+		if !slices.ContainsFunc(o, q.Implies) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equivalent returns whether l and o match the same media (see Implies).
+func (l List) Equivalent(o List) bool {
+	return l.Implies(o) && o.Implies(l)
+}
+
+// String returns the list in its normal form (e.g., "screen and (width >= 640px)").
+// It is "not all" for a list that matches nothing.
+func (l List) String() string {
+	if len(l) == 0 {
+		return "not all"
+	}
+	parts := make([]string, len(l))
+	for i, q := range l {
+		parts[i] = q.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// normalize sorts the list and leaves out the queries that imply another query of the list.
+func (l List) normalize() List {
+	for i := range l {
+		slices.SortFunc(l[i].Features, func(a, b Feature) int {
+			return cmp.Compare(a.String(), b.String())
+		})
+	}
+	slices.SortFunc(l, func(a, b Query) int {
+		return cmp.Compare(a.String(), b.String())
+	})
+	l = slices.CompactFunc(l, func(a, b Query) bool {
+		return a.String() == b.String()
+	})
+	var normal List
+	for i, q := range l {
+		redundant := false
+		for j, p := range l {
+			// of two equivalent queries, the first one is kept
+			if i != j && q.Implies(p) && (j < i || !p.Implies(q)) {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			normal = append(normal, q)
+		}
+	}
+	return normal
+}
+
+// Implies returns whether every medium that matches q matches o (see List.Implies).
+func (q Query) Implies(o Query) bool {
+	switch {
+	case q.Not && o.Not:
+		// not A implies not B if B implies A
+		return Query{Type: o.Type, Features: o.Features}.Implies(Query{Type: q.Type, Features: q.Features})
+	case o.Not:
+		// A implies not B if A and B never match together
+		return q.disjoint(Query{Type: o.Type, Features: o.Features})
+	case q.Not:
+		return o.Type == "all" && len(o.Features) == 0
+	}
+	if o.Type != "all" && o.Type != q.Type {
+		return false
+	}
+	for _, f := range o.Features {
+		if !slices.ContainsFunc(q.Features, func(g Feature) bool { return g.implies(f) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// disjoint returns whether two queries that are not negated never match the same medium.
+func (q Query) disjoint(o Query) bool {
+	if q.Type != "all" && o.Type != "all" && q.Type != o.Type {
+		return true
+	}
+	_, ok := and(q.Features, o.Features)
+	return !ok
+}
+
+// String returns the query in its normal form.
+func (q Query) String() string {
+	b := strings.Builder{}
+	if q.Not {
+		b.WriteString("not ")
+	}
+	if q.Not || q.Type != "all" || len(q.Features) == 0 {
+		b.WriteString(q.Type)
+		if len(q.Features) > 0 {
+			b.WriteString(" and ")
+		}
+	}
+	for i, f := range q.Features {
+		if i > 0 {
+			b.WriteString(" and ")
+		}
+		b.WriteString(f.String())
+	}
+	return b.String()
+}
+
+// IsRange returns whether f is a range feature.
+func (f Feature) IsRange() bool {
+	return f.kind != discrete
+}
+
+// implies returns whether every medium that has the feature f has the feature o.
+func (f Feature) implies(o Feature) bool {
+	if f.Name != o.Name || f.IsRange() != o.IsRange() {
+		return false
+	}
+	if o.IsRange() {
+		return o.Range.contains(f.Range)
+	}
+	if f == o {
+		return true
+	}
+	// (orientation: portrait) implies not (orientation: landscape)
+	return o.Not && !f.Not && f.Value != "" && o.Value != "" && f.Value != o.Value
+}
+
+// String returns the feature in its normal form (e.g., "(width >= 640px)" or "(not (hover: hover))").
+func (f Feature) String() string {
+	if !f.IsRange() {
+		s := "(" + f.Name + ")"
+		if f.Value != "" {
+			s = "(" + f.Name + ": " + f.Value + ")"
+		}
+		if f.Not {
+			s = "(not " + s + ")"
+		}
+		return s
+	}
+	r := f.Range
+	min, max := f.format(r.Min), f.format(r.Max)
+	switch {
+	case r.Min == r.Max:
+		return "(" + f.Name + ": " + min + ")"
+	case math.IsInf(r.Min, -1):
+		return "(" + f.Name + " " + operator("<", r.MaxExclusive) + " " + max + ")"
+	case math.IsInf(r.Max, 1):
+		return "(" + f.Name + " " + operator(">", r.MinExclusive) + " " + min + ")"
+	}
+	return "(" + min + " " + operator("<", r.MinExclusive) + " " + f.Name + " " + operator("<", r.MaxExclusive) + " " + max + ")"
+}
+
+// format returns a value of the feature with its unit.
+func (f Feature) format(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	switch f.kind {
+	case length:
+		return s + "px"
+	case resolution:
+		return s + "dppx"
+	}
+	return s
+}
+
+func operator(op string, exclusive bool) string {
+	if exclusive {
+		return op
+	}
+	return op + "="
+}
+
+// normalize normalizes the range of a range feature and returns false if it is empty.
+func (f *Feature) normalize() bool {
+	if !f.IsRange() {
+		return true
+	}
+	r := &f.Range
+	if f.kind == integer {
+		// x > 0 is x >= 1 and x < 8 is x <= 7
+		if min := math.Ceil(r.Min); r.MinExclusive && min == r.Min {
+			r.Min = min + 1
+		} else {
+			r.Min = min
+		}
+		if max := math.Floor(r.Max); r.MaxExclusive && max == r.Max {
+			r.Max = max - 1
+		} else {
+			r.Max = max
+		}
+		r.MinExclusive, r.MaxExclusive = false, false
+	}
+	// the values of range features are never negative, so width >= 0 is always true and width <= 0 is width: 0
+	if r.Min < 0 || (r.Min == 0 && !r.MinExclusive) {
+		r.Min, r.MinExclusive = math.Inf(-1), false
+	}
+	if r.Max < 0 || (r.Max == 0 && r.MaxExclusive) {
+		return false
+	}
+	if math.IsInf(r.Min, -1) && r.Max == 0 {
+		r.Min = 0
+	}
+	if math.IsInf(r.Max, 1) {
+		r.MaxExclusive = false
+	}
+	return r.Min < r.Max || (r.Min == r.Max && !r.MinExclusive && !r.MaxExclusive)
+}
+
+// unbounded returns whether the feature is a range feature that every medium has.
+func (f Feature) unbounded() bool {
+	return f.IsRange() && math.IsInf(f.Range.Min, -1) && math.IsInf(f.Range.Max, 1)
+}
+
+// newRange returns the range of all values.
+func newRange() Range {
+	return Range{Min: math.Inf(-1), Max: math.Inf(1)}
+}
+
+// intersect returns the values that are in both ranges.
+func (r Range) intersect(o Range) Range {
+	if o.Min > r.Min || (o.Min == r.Min && o.MinExclusive) {
+		r.Min, r.MinExclusive = o.Min, o.MinExclusive
+	}
+	if o.Max < r.Max || (o.Max == r.Max && o.MaxExclusive) {
+		r.Max, r.MaxExclusive = o.Max, o.MaxExclusive
+	}
+	return r
+}
+
+// contains returns whether all the values of o are in r.
+func (r Range) contains(o Range) bool {
+	min := o.Min > r.Min || (o.Min == r.Min && (o.MinExclusive || !r.MinExclusive))
+	max := o.Max < r.Max || (o.Max == r.Max && (o.MaxExclusive || !r.MaxExclusive))
+	return min && max
+}
+
+// complement returns the values that are not in r, as up to two ranges.
+func (r Range) complement() []Range {
+	var ranges []Range
+	if !math.IsInf(r.Min, -1) {
+		ranges = append(ranges, Range{Min: math.Inf(-1), Max: r.Min, MaxExclusive: !r.MinExclusive})
+	}
+	if !math.IsInf(r.Max, 1) {
+		ranges = append(ranges, Range{Min: r.Max, MinExclusive: !r.MaxExclusive, Max: math.Inf(1)})
+	}
+	return ranges
+}
+
+// and returns the features of a and b together, and false if no medium can have all of them.
+func and(a, b []Feature) ([]Feature, bool) {
+	features := slices.Clone(a)
+	for _, f := range b {
+		var ok bool
+		if features, ok = addFeature(features, f); !ok {
+			return nil, false
+		}
+	}
+	return features, true
+}
+
+// addFeature adds a feature to the features of a query, and returns false if no medium can have all of them.
+func addFeature(features []Feature, f Feature) ([]Feature, bool) {
+	if !f.normalize() {
+		return nil, false
+	}
+	if f.unbounded() {
+		return features, true
+	}
+	for i, g := range features {
+		if g.Name != f.Name || g.IsRange() != f.IsRange() {
+			continue
+		}
+		if f.IsRange() {
+			g.Range = g.Range.intersect(f.Range)
+			if !g.normalize() {
+				return nil, false
+			}
+			features[i] = g
+			return features, true
+		}
+		switch {
+		case g == f:
+			return features, true
+		case g.Value == f.Value && g.Not != f.Not:
+			return nil, false
+		case !g.Not && !f.Not && g.Value != "" && f.Value != "":
+			// a feature has a single value
+			return nil, false
+		}
+	}
+	return append(features, f), true
+}
+
+// token is a token of a media query without whitespace. The comparisons "<=" and ">=" are a single delimiter.
+type token struct {
+	tt   css.TokenType
+	data string
+}
+
+func tokenize(s string) ([]token, error) {
+	l := css.NewLexer(parse.NewInputString(s))
+	var tokens []token
+	space := false
+	for {
+		tt, data := l.Next()
+		switch tt {
+		case css.ErrorToken:
+			if err := l.Err(); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return tokens, nil
+		case css.WhitespaceToken, css.CommentToken:
+			space = true
+			continue
+		}
+		t := token{tt: tt, data: string(data)}
+		if n := len(tokens); n > 0 && !space && t.tt == css.DelimToken && t.data == "=" &&
+			tokens[n-1].tt == css.DelimToken && (tokens[n-1].data == "<" || tokens[n-1].data == ">") {
+			tokens[n-1].data += "="
+		} else {
+			tokens = append(tokens, t)
+		}
+		space = false
+	}
+}
+
+// expr is a media condition: a feature, or "not", "and" or "or" of conditions.
+type expr struct {
+	op      byte // '!', '&' or '|', 0 for a feature
+	args    []*expr
+	feature Feature
+}
+
+// parser parses the tokens of a single media query.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{tt: css.ErrorToken}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// keyword returns the keyword of an identifier token in lower case, or an empty string.
+func (t token) keyword() string {
+	if t.tt != css.IdentToken {
+		return ""
+	}
+	return strings.ToLower(t.data)
+}
+
+func (p *parser) unexpected() error {
+	if t := p.peek(); t.tt != css.ErrorToken {
+		return fmt.Errorf("unexpected %q in media query", t.data)
+	}
+	return fmt.Errorf("unexpected end of media query")
+}
+
+// parseQuery parses a media query into the queries of a List.
+func parseQuery(tokens []token) ([]Query, error) {
+	p := &parser{tokens: tokens}
+	if len(tokens) == 0 {
+		return nil, p.unexpected()
+	}
+	not := false
+	mediaType := ""
+	switch k := p.peek().keyword(); {
+	case k == "only":
+		p.next()
+		if mediaType = p.next().keyword(); mediaType == "" {
+			return nil, p.unexpected()
+		}
+	case k == "not" && p.pos+1 < len(tokens) && tokens[p.pos+1].tt == css.IdentToken:
+		p.next()
+		not, mediaType = true, p.next().keyword()
+	case k != "" && k != "not":
+		mediaType = p.next().keyword()
+	}
+	if mediaType == "and" || mediaType == "or" || mediaType == "not" || mediaType == "only" || mediaType == "layer" {
+		return nil, fmt.Errorf("unexpected %q in media query", mediaType)
+	}
+
+	var condition *expr
+	if mediaType == "" {
+		c, err := p.parseCondition(true)
+		if err != nil {
+			return nil, err
+		}
+		condition, mediaType = c, "all"
+	} else if p.peek().keyword() == "and" {
+		p.next()
+		c, err := p.parseCondition(false)
+		if err != nil {
+			return nil, err
+		}
+		condition = c
+	}
+	if p.pos != len(tokens) {
+		return nil, p.unexpected()
+	}
+
+	if not && mediaType == "all" {
+		// not all and (a) is not (a)
+		condition, not = &expr{op: '!', args: []*expr{condition}}, false
+		if condition.args[0] == nil {
+			return nil, nil
+		}
+	}
+	conjunctions, err := dnf(condition, false)
+	if err != nil {
+		return nil, err
+	}
+	if not {
+		switch len(conjunctions) {
+		case 0:
+			// the negation of a condition that is never true
+			return []Query{{Type: "all"}}, nil
+		case 1:
+			return []Query{{Not: true, Type: mediaType, Features: conjunctions[0]}}, nil
+		}
+		return nil, fmt.Errorf("cannot normalize a negated media query with \"or\"")
+	}
+	queries := make([]Query, len(conjunctions))
+	for i, c := range conjunctions {
+		queries[i] = Query{Type: mediaType, Features: c}
+	}
+	return queries, nil
+}
+
+// parseCondition parses a media condition. Only a condition after a media type cannot use "or".
+func (p *parser) parseCondition(or bool) (*expr, error) {
+	if p.peek().keyword() == "not" {
+		p.next()
+		e, err := p.parseInParens()
+		if err != nil {
+			return nil, err
+		}
+		return &expr{op: '!', args: []*expr{e}}, nil
+	}
+	e, err := p.parseInParens()
+	if err != nil {
+		return nil, err
+	}
+	args := []*expr{e}
+	var op byte
+	for {
+		var o byte
+		switch p.peek().keyword() {
+		case "and":
+			o = '&'
+		case "or":
+			if !or {
+				return nil, p.unexpected()
+			}
+			o = '|'
+		default:
+			if op == 0 {
+				return e, nil
+			}
+			return &expr{op: op, args: args}, nil
+		}
+		if op != 0 && o != op {
+			// "and" and "or" cannot be mixed without parentheses
+			return nil, p.unexpected()
+		}
+		op = o
+		p.next()
+		e, err := p.parseInParens()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, e)
+	}
+}
+
+// parseInParens parses a condition or a feature in parentheses.
+func (p *parser) parseInParens() (*expr, error) {
+	if p.peek().tt != css.LeftParenthesisToken {
+		return nil, p.unexpected()
+	}
+	p.next()
+	if t := p.peek(); t.tt == css.LeftParenthesisToken || t.keyword() == "not" {
+		e, err := p.parseCondition(true)
+		if err != nil {
+			return nil, err
+		}
+		if p.next().tt != css.RightParenthesisToken {
+			return nil, p.unexpected()
+		}
+		return e, nil
+	}
+	start := p.pos
+	for p.peek().tt != css.RightParenthesisToken {
+		if p.peek().tt == css.ErrorToken {
+			return nil, p.unexpected()
+		}
+		p.next()
+	}
+	f, err := parseFeature(p.tokens[start:p.pos])
+	if err != nil {
+		return nil, err
+	}
+	p.next()
+	return &expr{feature: f}, nil
+}
+
+// parseFeature parses the tokens of a media feature inside its parentheses.
+func parseFeature(tokens []token) (Feature, error) {
+	if len(tokens) == 0 {
+		return Feature{}, fmt.Errorf("empty media feature")
+	}
+	for _, t := range tokens {
+		if t.tt == css.FunctionToken || t.tt == css.LeftParenthesisToken {
+			return Feature{}, fmt.Errorf("unsupported media feature value %q", t.data)
+		}
+	}
+	name := tokens[0].keyword()
+
+	// boolean: (hover)
+	if len(tokens) == 1 {
+		if name == "" {
+			return Feature{}, fmt.Errorf("unexpected %q in media feature", tokens[0].data)
+		}
+		f := Feature{Name: name, kind: rangeFeatures[name]}
+		if f.IsRange() {
+			// a range feature is true if it is not zero
+			f.Range = Range{Min: 0, MinExclusive: true, Max: math.Inf(1)}
+		}
+		return f, nil
+	}
+
+	// plain: (min-width: 640px) or (orientation: portrait)
+	if name != "" && tokens[1].tt == css.ColonToken {
+		value := tokens[2:]
+		if len(value) == 0 {
+			return Feature{}, fmt.Errorf("missing value of media feature %q", name)
+		}
+		prefix, base, _ := strings.Cut(name, "-")
+		if kind, ok := rangeFeatures[base]; ok && (prefix == "min" || prefix == "max") {
+			op := ">="
+			if prefix == "max" {
+				op = "<="
+			}
+			return rangeFeature(base, kind, op, value)
+		}
+		if kind, ok := rangeFeatures[name]; ok {
+			return rangeFeature(name, kind, "=", value)
+		}
+		b := strings.Builder{}
+		for _, t := range value {
+			b.WriteString(t.data)
+		}
+		v := b.String()
+		if len(value) == 1 && value[0].tt == css.IdentToken {
+			v = strings.ToLower(v)
+		}
+		return Feature{Name: name, Value: v}, nil
+	}
+
+	// range: (width >= 640px), (640px <= width) or (640px <= width < 768px)
+	var parts [][]token
+	var ops []string
+	start := 0
+	for i, t := range tokens {
+		if t.tt == css.DelimToken && slices.Contains([]string{"<", "<=", ">", ">=", "="}, t.data) {
+			parts = append(parts, tokens[start:i])
+			ops = append(ops, t.data)
+			start = i + 1
+		}
+	}
+	parts = append(parts, tokens[start:])
+	isName := func(part []token) bool {
+		_, ok := rangeFeatures[part[0].keyword()]
+		return len(part) == 1 && ok
+	}
+	for _, part := range parts {
+		if len(part) == 0 {
+			return Feature{}, fmt.Errorf("invalid media feature range")
+		}
+	}
+	switch {
+	case len(parts) == 2 && isName(parts[0]):
+		name = parts[0][0].keyword()
+		return rangeFeature(name, rangeFeatures[name], ops[0], parts[1])
+	case len(parts) == 2 && isName(parts[1]):
+		name = parts[1][0].keyword()
+		return rangeFeature(name, rangeFeatures[name], flip(ops[0]), parts[0])
+	case len(parts) == 3 && isName(parts[1]) && ops[0] != "=" && ops[0][0] == ops[1][0]:
+		name = parts[1][0].keyword()
+		f, err := rangeFeature(name, rangeFeatures[name], flip(ops[0]), parts[0])
+		if err != nil {
+			return Feature{}, err
+		}
+		g, err := rangeFeature(name, rangeFeatures[name], ops[1], parts[2])
+		if err != nil {
+			return Feature{}, err
+		}
+		f.Range = f.Range.intersect(g.Range)
+		return f, nil
+	}
+	return Feature{}, fmt.Errorf("invalid media feature range")
+}
+
+// flip returns the comparison with its operands swapped (a < b is b > a).
+func flip(op string) string {
+	switch op[0] {
+	case '<':
+		return ">" + op[1:]
+	case '>':
+		return "<" + op[1:]
+	}
+	return op
+}
+
+// rangeFeature returns a range feature that compares the feature with a value: name op value.
+func rangeFeature(name string, kind valueKind, op string, value []token) (Feature, error) {
+	v, err := parseValue(kind, value)
+	if err != nil {
+		return Feature{}, err
+	}
+	f := Feature{Name: name, Range: newRange(), kind: kind}
+	switch op {
+	case "<", "<=":
+		f.Range.Max, f.Range.MaxExclusive = v, op == "<"
+	case ">", ">=":
+		f.Range.Min, f.Range.MinExclusive = v, op == ">"
+	default:
+		f.Range.Min, f.Range.Max = v, v
+	}
+	return f, nil
+}
+
+// parseValue parses a value of a range feature in the unit of its Range.
+func parseValue(kind valueKind, value []token) (float64, error) {
+	invalid := func() (float64, error) {
+		b := strings.Builder{}
+		for _, t := range value {
+			b.WriteString(t.data)
+		}
+		return 0, fmt.Errorf("invalid media feature value %q", b.String())
+	}
+	if kind == ratio && len(value) == 3 && value[1].tt == css.DelimToken && value[1].data == "/" {
+		a, err := strconv.ParseFloat(value[0].data, 64)
+		if err != nil || value[0].tt != css.NumberToken {
+			return invalid()
+		}
+		b, err := strconv.ParseFloat(value[2].data, 64)
+		if err != nil || value[2].tt != css.NumberToken || b == 0 {
+			return invalid()
+		}
+		return a / b, nil
+	}
+	if len(value) != 1 {
+		return invalid()
+	}
+	t := value[0]
+	if t.tt == css.NumberToken {
+		n, err := strconv.ParseFloat(t.data, 64)
+		if err != nil || (kind != ratio && kind != integer && n != 0) {
+			// a length or a resolution needs a unit, except for zero
+			return invalid()
+		}
+		return n, nil
+	}
+	if t.tt != css.DimensionToken {
+		return invalid()
+	}
+	i := strings.LastIndexAny(t.data, "0123456789.") + 1
+	n, err := strconv.ParseFloat(t.data[:i], 64)
+	if err != nil {
+		return invalid()
+	}
+	switch unit := strings.ToLower(t.data[i:]); {
+	case kind == length && unit == "px":
+		return n, nil
+	case kind == length && (unit == "em" || unit == "rem"):
+		// relative units in media queries are relative to the initial font size
+		return n * 16, nil
+	case kind == resolution && (unit == "dppx" || unit == "x"):
+		return n, nil
+	case kind == resolution && unit == "dpi":
+		return n / 96, nil
+	case kind == resolution && unit == "dpcm":
+		return n * 2.54 / 96, nil
+	}
+	return invalid()
+}
+
+// dnf returns a condition (or its negation) as a disjunction of conjunctions of features
+// that a medium can have. A nil condition is always true.
+func dnf(e *expr, negate bool) ([][]Feature, error) {
+	if e == nil {
+		if negate {
+			return nil, nil
+		}
+		return [][]Feature{nil}, nil
+	}
+	switch {
+	case e.op == '!':
+		return dnf(e.args[0], !negate)
+	case e.op == '|' && !negate, e.op == '&' && negate:
+		// not (a and b) is not a or not b
+		var conjunctions [][]Feature
+		for _, a := range e.args {
+			c, err := dnf(a, negate)
+			if err != nil {
+				return nil, err
+			}
+			conjunctions = append(conjunctions, c...)
+			if len(conjunctions) > maxQueries {
+				return nil, fmt.Errorf("media query has too many conditions")
+			}
+		}
+		return conjunctions, nil
+	case e.op == '&', e.op == '|':
+		// not (a or b) is not a and not b
+		conjunctions := [][]Feature{nil}
+		for _, a := range e.args {
+			c, err := dnf(a, negate)
+			if err != nil {
+				return nil, err
+			}
+			var product [][]Feature
+			for _, x := range conjunctions {
+				for _, y := range c {
+					if features, ok := and(x, y); ok {
+						product = append(product, features)
+					}
+				}
+			}
+			if len(product) > maxQueries {
+				return nil, fmt.Errorf("media query has too many conditions")
+			}
+			conjunctions = product
+		}
+		return conjunctions, nil
+	}
+
+	f := e.feature
+	if !f.normalize() {
+		// a feature no medium has, like (width < 0px)
+		if negate {
+			return [][]Feature{nil}, nil
+		}
+		return nil, nil
+	}
+	var features []Feature
+	switch {
+	case !negate:
+		features = []Feature{f}
+	case f.IsRange():
+		for _, r := range f.Range.complement() {
+			g := f
+			g.Range = r
+			features = append(features, g)
+		}
+	default:
+		f.Not = !f.Not
+		features = []Feature{f}
+	}
+	var conjunctions [][]Feature
+	for _, f := range features {
+		if c, ok := addFeature(nil, f); ok {
+			conjunctions = append(conjunctions, c)
+		}
+	}
+	return conjunctions, nil
+}
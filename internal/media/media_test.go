@@ -0,0 +1,176 @@
+package media
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		in   string
+		want string
+	}{
+		{in: "", want: "all"},
+		{in: "all", want: "all"},
+		{in: "SCREEN", want: "screen"},
+		{in: "only screen", want: "screen"},
+		{in: "not print", want: "not print"},
+		{in: "not all", want: "not all"},
+		{in: "(min-width: 768px)", want: "(width >= 768px)"},
+		{in: "(min-width:768px)", want: "(width >= 768px)"},
+		{in: "( MIN-WIDTH : 48rem )", want: "(width >= 768px)"},
+		{in: "(min-width: 48em)", want: "(width >= 768px)"},
+		{in: "(width >= 768px)", want: "(width >= 768px)"},
+		{in: "(768px <= width)", want: "(width >= 768px)"},
+		{in: "(768px < width)", want: "(width > 768px)"},
+		{in: "(width: 600px)", want: "(width: 600px)"},
+		{in: "(width = 600px)", want: "(width: 600px)"},
+		{in: "(400px <= width < 700px)", want: "(400px <= width < 700px)"},
+		{in: "(min-width: 400px) and (max-width: 700px)", want: "(400px <= width <= 700px)"},
+		{in: "(min-width: 400px) and (min-width: 500px)", want: "(width >= 500px)"},
+		{in: "(min-width: 0)", want: "all"},
+		{in: "only screen and (max-width: 639px)", want: "screen and (width <= 639px)"},
+		{in: "not all and (min-width: 640px)", want: "(width < 640px)"},
+		{in: "not (width < 640px)", want: "(width >= 640px)"},
+		{in: "not ((min-width: 640px) and (max-width: 767px))", want: "(width < 640px), (width > 767px)"},
+		{in: "(min-width: 640px) or (orientation: portrait)", want: "(orientation: portrait), (width >= 640px)"},
+		{in: "screen and ((min-width: 640px) or (hover))", want: "screen and (hover), screen and (width >= 640px)"},
+		{in: "(min-width: 640px), (min-width: 768px)", want: "(width >= 640px)"},
+		{in: "screen and (min-width: 640px), (min-width: 768px)", want: "(width >= 768px), screen and (width >= 640px)"},
+		{in: "(min-width: 640px), all", want: "all"},
+		{in: "print, screen", want: "print, screen"},
+		{in: "screen, print", want: "print, screen"},
+		{in: "(width >= 800px) and (width < 400px)", want: "not all"},
+		{in: "(orientation: landscape) and (orientation: portrait)", want: "not all"},
+		{in: "(orientation: PORTRAIT) and (hover: hover)", want: "(hover: hover) and (orientation: portrait)"},
+		{in: "not (hover: hover)", want: "(not (hover: hover))"},
+		{in: "not screen and (color)", want: "not screen and (color >= 1)"},
+		{in: "(min-color: 1)", want: "(color >= 1)"},
+		{in: "(color > 2) and (color < 8)", want: "(3 <= color <= 7)"},
+		{in: "(min-resolution: 192dpi)", want: "(resolution >= 2dppx)"},
+		{in: "(min-resolution: 2x)", want: "(resolution >= 2dppx)"},
+		{in: "(min-aspect-ratio: 4/2)", want: "(aspect-ratio >= 2)"},
+		{in: "(prefers-reduced-motion: no-preference)", want: "(prefers-reduced-motion: no-preference)"},
+		{in: "(-webkit-min-device-pixel-ratio: 2)", want: "(-webkit-min-device-pixel-ratio: 2)"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := Parse(tc.in)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			if s := got.String(); s != tc.want {
+				t.Errorf("Parse returned %q, want %q", s, tc.want)
+			}
+			// the normal form parses to itself
+			again, err := Parse(got.String())
+			if err != nil {
+				t.Fatalf("Parse of the normal form returned error: %v", err)
+			}
+			if s := again.String(); s != tc.want {
+				t.Errorf("Parse of the normal form returned %q, want %q", s, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tt := []string{
+		"(min-width: calc(100px + 1em))",
+		"(min-width: 10vw)",
+		"(min-width: 10)",
+		"(min-width:)",
+		"(width >= )",
+		"(width < 10px > 20px)",
+		"screen and (hover) or (color)",
+		"(hover) and (color) or (grid)",
+		"not screen and ((hover) or (color))",
+		"screen and",
+		"and",
+		"(hover",
+		"screen, ",
+	}
+
+	for _, in := range tt {
+		t.Run(in, func(t *testing.T) {
+			if got, err := Parse(in); err == nil {
+				t.Errorf("Parse returned %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestImplies(t *testing.T) {
+	tt := []struct {
+		a, b    string
+		implies bool
+	}{
+		{a: "(min-width: 768px)", b: "(min-width: 640px)", implies: true},
+		{a: "(min-width: 640px)", b: "(min-width: 768px)", implies: false},
+		{a: "screen and (min-width: 768px)", b: "(min-width: 640px)", implies: true},
+		{a: "(min-width: 768px)", b: "screen and (min-width: 640px)", implies: false},
+		{a: "(min-width: 640px) and (hover: hover)", b: "(hover: hover)", implies: true},
+		{a: "(width: 700px)", b: "(640px <= width < 768px)", implies: true},
+		{a: "(width > 640px)", b: "(width >= 640px)", implies: true},
+		{a: "(width >= 640px)", b: "(width > 640px)", implies: false},
+		{a: "print", b: "not screen", implies: true},
+		{a: "not screen", b: "print", implies: false},
+		{a: "not screen", b: "not screen and (color)", implies: true},
+		{a: "(orientation: portrait)", b: "not all and (orientation: landscape)", implies: true},
+		{a: "(min-width: 768px)", b: "(min-width: 640px), print", implies: true},
+		{a: "(min-width: 768px), print", b: "(min-width: 640px)", implies: false},
+		{a: "not all", b: "print", implies: true},
+		{a: "print", b: "all", implies: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.a+" => "+tc.b, func(t *testing.T) {
+			a, err := Parse(tc.a)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			b, err := Parse(tc.b)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			if got := a.Implies(b); got != tc.implies {
+				t.Errorf("Implies returned %v, want %v", got, tc.implies)
+			}
+		})
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	tt := []struct {
+		a, b       string
+		equivalent bool
+	}{
+		{a: "(min-width: 768px)", b: "(min-width:48rem)", equivalent: true},
+		{a: "(min-width: 768px)", b: "(width >= 48em)", equivalent: true},
+		{a: "not all and (min-width: 640px)", b: "(width < 640px)", equivalent: true},
+		{a: "(max-width: 639px)", b: "(width < 640px)", equivalent: false},
+		{a: "(color)", b: "(min-color: 1)", equivalent: true},
+		{a: "screen, print", b: "print, screen", equivalent: true},
+		{a: "screen", b: "all", equivalent: false},
+		{a: "not screen and (color)", b: "not screen and (min-color: 1)", equivalent: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.a+" <=> "+tc.b, func(t *testing.T) {
+			a, err := Parse(tc.a)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			b, err := Parse(tc.b)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			if got := a.Equivalent(b); got != tc.equivalent {
+				t.Errorf("Equivalent returned %v, want %v", got, tc.equivalent)
+			}
+			if got := a.String() == b.String(); got != tc.equivalent {
+				t.Errorf("String returned %q and %q", a, b)
+			}
+		})
+	}
+}
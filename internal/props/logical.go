@@ -0,0 +1,182 @@
+package props
+
+import (
+	"slices"
+	"strings"
+)
+
+// Direction is the inline base direction of a document in a horizontal writing mode,
+// which decides the physical side a logical property maps to.
+type Direction int
+
+const (
+	DirectionUnknown Direction = iota // the direction or the writing mode is not known
+	LTR                               // left to right (e.g., English)
+	RTL                               // right to left (e.g., Arabic)
+)
+
+// See https://drafts.csswg.org/css-logical/ for the logical properties and how they map to physical properties.
+
+// logicalLonghands maps each logical longhand to the physical longhand it is in a horizontal writing mode, in LTR and in RTL.
+var logicalLonghands = map[string][2]string{}
+
+// logicalDimensions maps each logical dimension (e.g., inline-size) to the physical dimension it is in a horizontal writing mode,
+// which is the same in LTR and in RTL.
+var logicalDimensions = map[string]string{}
+
+// logicalAxes maps the logical shorthands of an axis to their longhands (e.g., border-inline-width to border-inline-start-width and border-inline-end-width).
+// The property data only expands some of them.
+var logicalAxes = map[string][]string{}
+
+// logicalBoxes are the physical longhands of a box (e.g., the four sides of the padding),
+// with the logical longhands they set together in any direction and writing mode.
+var logicalBoxes []logicalBox
+
+type logicalBox struct {
+	physical []string
+	logical  []string
+}
+
+func init() {
+	// the sides of a box, in the order top, right, bottom, left
+	physicalSides := []string{"top", "right", "bottom", "left"}
+	logicalSides := []string{"block-start", "inline-end", "block-end", "inline-start"}
+	rtlSides := []string{"top", "left", "bottom", "right"}
+	sides := []struct{ physical, logical string }{
+		{physical: "margin-*", logical: "margin-*"},
+		{physical: "padding-*", logical: "padding-*"},
+		{physical: "scroll-margin-*", logical: "scroll-margin-*"},
+		{physical: "scroll-padding-*", logical: "scroll-padding-*"},
+		{physical: "*", logical: "inset-*"},
+		{physical: "border-*-width", logical: "border-*-width"},
+		{physical: "border-*-style", logical: "border-*-style"},
+		{physical: "border-*-color", logical: "border-*-color"},
+	}
+	for _, s := range sides {
+		box := logicalBox{}
+		for i := range physicalSides {
+			logical := strings.Replace(s.logical, "*", logicalSides[i], 1)
+			ltr := strings.Replace(s.physical, "*", physicalSides[i], 1)
+			rtl := strings.Replace(s.physical, "*", rtlSides[i], 1)
+			logicalLonghands[logical] = [2]string{ltr, rtl}
+			box.physical = append(box.physical, ltr)
+			box.logical = append(box.logical, logical)
+		}
+		for _, axis := range []string{"inline", "block"} {
+			shorthand := strings.Replace(s.logical, "*", axis, 1)
+			logicalAxes[shorthand] = []string{
+				strings.Replace(s.logical, "*", axis+"-start", 1),
+				strings.Replace(s.logical, "*", axis+"-end", 1),
+			}
+		}
+		logicalBoxes = append(logicalBoxes, box)
+	}
+
+	// the corners of a box, named block side first
+	corners := []struct{ logical, ltr, rtl string }{
+		{logical: "start-start", ltr: "top-left", rtl: "top-right"},
+		{logical: "start-end", ltr: "top-right", rtl: "top-left"},
+		{logical: "end-end", ltr: "bottom-right", rtl: "bottom-left"},
+		{logical: "end-start", ltr: "bottom-left", rtl: "bottom-right"},
+	}
+	radius := logicalBox{}
+	for _, c := range corners {
+		logical := "border-" + c.logical + "-radius"
+		logicalLonghands[logical] = [2]string{"border-" + c.ltr + "-radius", "border-" + c.rtl + "-radius"}
+		radius.physical = append(radius.physical, "border-"+c.ltr+"-radius")
+		radius.logical = append(radius.logical, logical)
+	}
+	logicalBoxes = append(logicalBoxes, radius)
+
+	// the dimensions of a box, which do not depend on the direction in a horizontal writing mode
+	dimensions := []struct{ inline, block, width, height string }{
+		{inline: "inline-size", block: "block-size", width: "width", height: "height"},
+		{inline: "min-inline-size", block: "min-block-size", width: "min-width", height: "min-height"},
+		{inline: "max-inline-size", block: "max-block-size", width: "max-width", height: "max-height"},
+		{inline: "contain-intrinsic-inline-size", block: "contain-intrinsic-block-size", width: "contain-intrinsic-width", height: "contain-intrinsic-height"},
+		{inline: "overflow-inline", block: "overflow-block", width: "overflow-x", height: "overflow-y"},
+		{inline: "overscroll-behavior-inline", block: "overscroll-behavior-block", width: "overscroll-behavior-x", height: "overscroll-behavior-y"},
+	}
+	for _, d := range dimensions {
+		logicalDimensions[d.inline] = d.width
+		logicalDimensions[d.block] = d.height
+	}
+}
+
+// IsLogical returns whether a property is a logical longhand or a logical shorthand of an axis (e.g., padding-inline-start or border-inline-width).
+func IsLogical(name string) bool {
+	_, longhand := logicalLonghands[name]
+	_, dimension := logicalDimensions[name]
+	_, axis := logicalAxes[name]
+	return longhand || dimension || axis
+}
+
+// Physical returns the physical longhand a logical longhand maps to in a horizontal writing mode with the given direction
+// (e.g., padding-inline-start is padding-left in LTR and padding-right in RTL).
+// The dimensions of a box (e.g., inline-size) do not depend on the direction, so they are mapped whatever the direction.
+// It returns the property itself if it is not a logical longhand, or if it is a side or a corner and the direction is unknown.
+func Physical(name string, dir Direction) string {
+	if p, ok := logicalDimensions[name]; ok {
+		return p
+	}
+	if p, ok := logicalLonghands[name]; ok && dir != DirectionUnknown {
+		return p[dir-1]
+	}
+	return name
+}
+
+// ResolveLogical returns the longhands that a list of longhands (see Property.ComputedProps) sets,
+// with the logical properties related to the physical properties.
+// Logical shorthands of an axis (e.g., border-inline-width) are expanded to their longhands first.
+// With a known direction, each logical longhand is replaced by the physical longhand it maps to (see Physical).
+// With an unknown direction, only the logical dimensions are replaced. The logical sides and corners are kept, and the logical longhands of a box are added
+// if all the physical longhands of the box are in the list, because they are set whatever the direction and writing mode
+// (e.g., padding sets padding-inline-start, but padding-left and padding-right do not, because of vertical writing modes).
+// The list is returned as is if there is nothing to resolve.
+func ResolveLogical(properties []string, dir Direction) []string {
+	resolve := false
+	for _, p := range properties {
+		if IsLogical(p) {
+			resolve = true
+			break
+		}
+	}
+	if !resolve && dir != DirectionUnknown {
+		return properties
+	}
+
+	resolved := make([]string, 0, len(properties))
+	for _, p := range properties {
+		if longhands, ok := logicalAxes[p]; ok {
+			for _, l := range longhands {
+				resolved = append(resolved, Physical(l, dir))
+			}
+			continue
+		}
+		resolved = append(resolved, Physical(p, dir))
+	}
+	if dir != DirectionUnknown {
+		return resolved
+	}
+
+	n := len(resolved)
+	for _, box := range logicalBoxes {
+		if containsAll(resolved[:n], box.physical) {
+			resolved = append(resolved, box.logical...)
+		}
+	}
+	if !resolve && len(resolved) == n {
+		return properties
+	}
+	return resolved
+}
+
+// containsAll returns whether all the properties of want are in properties.
+func containsAll(properties []string, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(properties, w) {
+			return false
+		}
+	}
+	return true
+}
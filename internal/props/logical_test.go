@@ -0,0 +1,69 @@
+package props
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPhysical(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		name string
+		dir  Direction
+		want string
+	}{
+		{name: "padding-inline-start", dir: LTR, want: "padding-left"},
+		{name: "padding-inline-start", dir: RTL, want: "padding-right"},
+		{name: "padding-inline-start", dir: DirectionUnknown, want: "padding-inline-start"},
+		{name: "margin-inline-end", dir: LTR, want: "margin-right"},
+		{name: "margin-block-start", dir: RTL, want: "margin-top"},
+		{name: "inset-inline-end", dir: RTL, want: "left"},
+		{name: "border-inline-start-width", dir: LTR, want: "border-left-width"},
+		{name: "border-start-end-radius", dir: LTR, want: "border-top-right-radius"},
+		{name: "border-start-end-radius", dir: RTL, want: "border-top-left-radius"},
+		{name: "border-end-start-radius", dir: RTL, want: "border-bottom-right-radius"},
+		{name: "inline-size", dir: RTL, want: "width"},
+		{name: "max-block-size", dir: LTR, want: "max-height"},
+		{name: "inline-size", dir: DirectionUnknown, want: "width"},
+		{name: "padding-left", dir: LTR, want: "padding-left"},
+		{name: "color", dir: RTL, want: "color"},
+	}
+	for _, tc := range tt {
+		if got := Physical(tc.name, tc.dir); got != tc.want {
+			t.Errorf("Physical(%q, %v) = %q, want %q", tc.name, tc.dir, got, tc.want)
+		}
+	}
+}
+
+func TestResolveLogical(t *testing.T) {
+	t.Parallel()
+	tt := []struct {
+		in   []string
+		dir  Direction
+		want []string
+	}{
+		{in: []string{"padding-inline-start", "padding-inline-end"}, dir: LTR, want: []string{"padding-left", "padding-right"}},
+		{in: []string{"padding-inline-start", "padding-inline-end"}, dir: RTL, want: []string{"padding-right", "padding-left"}},
+		{in: []string{"border-inline-width"}, dir: LTR, want: []string{"border-left-width", "border-right-width"}},
+		{in: []string{"border-inline-width"}, dir: DirectionUnknown, want: []string{"border-inline-start-width", "border-inline-end-width"}},
+		{in: []string{"padding-inline-start"}, dir: DirectionUnknown, want: []string{"padding-inline-start"}},
+		{
+			in:  []string{"padding-bottom", "padding-left", "padding-right", "padding-top"},
+			dir: DirectionUnknown,
+			want: []string{
+				"padding-bottom", "padding-left", "padding-right", "padding-top",
+				"padding-block-start", "padding-inline-end", "padding-block-end", "padding-inline-start",
+			},
+		},
+		{in: []string{"padding-left", "padding-right"}, dir: DirectionUnknown, want: []string{"padding-left", "padding-right"}},
+		{in: []string{"width", "height"}, dir: DirectionUnknown, want: []string{"width", "height"}},
+		{in: []string{"inline-size", "block-size"}, dir: DirectionUnknown, want: []string{"width", "height"}},
+		{in: []string{"padding-bottom", "padding-left", "padding-right", "padding-top"}, dir: LTR, want: []string{"padding-bottom", "padding-left", "padding-right", "padding-top"}},
+		{in: []string{"color"}, dir: DirectionUnknown, want: []string{"color"}},
+	}
+	for _, tc := range tt {
+		if got := ResolveLogical(tc.in, tc.dir); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ResolveLogical(%v, %v) = %v, want %v", tc.in, tc.dir, got, tc.want)
+		}
+	}
+}
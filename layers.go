@@ -0,0 +1,121 @@
+package merge
+
+import (
+	"strings"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+)
+
+// layerOrder keeps track of the cascade layers declared by the stylesheets added to a Merger.
+// Layers are ordered by first declaration. For normal declarations, a later layer beats an earlier one,
+// a layer's own rules beat the rules of its sub-layers, and rules outside of any layer beat all layers.
+// See https://developer.mozilla.org/en-US/docs/Web/CSS/@layer
+type layerOrder struct {
+	root      layerNode
+	ranks     map[string]int // full layer name to priority. Higher wins.
+	anonymous int            // the number of anonymous layers declared
+}
+
+type layerNode struct {
+	name     string // full name of the layer (e.g., "base.reset")
+	children []*layerNode
+}
+
+func newLayerOrder() *layerOrder {
+	return &layerOrder{ranks: map[string]int{"": 0}}
+}
+
+// declare registers a full layer name (e.g., "base.reset"), including any parent layers.
+// Declaring a layer that already exists does not change its position.
+func (o *layerOrder) declare(name string) {
+	node := &o.root
+	full := ""
+	for _, part := range strings.Split(name, ".") {
+		if full == "" {
+			full = part
+		} else {
+			full = full + "." + part
+		}
+		var child *layerNode
+		for _, c := range node.children {
+			if c.name == full {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			child = &layerNode{name: full}
+			node.children = append(node.children, child)
+		}
+		node = child
+	}
+	o.rank()
+}
+
+// renameAnonymous gives the anonymous layers of a stylesheet names that are not used by the layers declared so far.
+// Anonymous layers are never shared, even between stylesheets, but they are numbered in the order of each stylesheet.
+// It must be called before the layers of the stylesheet are declared.
+func (o *layerOrder) renameAnonymous(sheet *cascadia.Stylesheet) {
+	names := make(map[string]string) // the name in the stylesheet to the name in the layer order
+	sheet.RenameLayers(func(full string) string {
+		parts := strings.Split(full, ".")
+		for i, part := range parts {
+			if !cascadia.IsAnonymousLayer(part) {
+				continue
+			}
+			name, ok := names[part]
+			if !ok {
+				o.anonymous++
+				name = cascadia.AnonymousLayerName(o.anonymous)
+				names[part] = name
+			}
+			parts[i] = name
+		}
+		return strings.Join(parts, ".")
+	})
+}
+
+// rank recalculates the priority of every layer.
+// The layer tree is walked depth first and a layer is ranked after all its sub-layers,
+// so the unlayered rules (the root) always get the highest rank.
+func (o *layerOrder) rank() {
+	ranks := make(map[string]int, len(o.ranks)+1)
+	next := 0
+	var visit func(n *layerNode)
+	visit = func(n *layerNode) {
+		for _, c := range n.children {
+			visit(c)
+		}
+		ranks[n.name] = next
+		next++
+	}
+	visit(&o.root)
+	o.ranks = ranks
+}
+
+// get returns the priority of a layer. Higher wins.
+// Unknown layers are treated as unlayered.
+func (o *layerOrder) get(name string) int {
+	if rank, ok := o.ranks[name]; ok {
+		return rank
+	}
+	return o.ranks[""]
+}
+
+// clone returns a copy of the layer order that can be changed without changing o.
+func (o *layerOrder) clone() *layerOrder {
+	c := &layerOrder{root: o.root.clone(), ranks: make(map[string]int, len(o.ranks)), anonymous: o.anonymous}
+	for name, rank := range o.ranks {
+		c.ranks[name] = rank
+	}
+	return c
+}
+
+func (n *layerNode) clone() layerNode {
+	c := layerNode{name: n.name, children: make([]*layerNode, len(n.children))}
+	for i, child := range n.children {
+		cc := child.clone()
+		c.children[i] = &cc
+	}
+	return c
+}
@@ -0,0 +1,52 @@
+package merge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLayerOrder(t *testing.T) {
+	o := newLayerOrder()
+	for _, name := range []string{"reset", "components", "components.variants", "reset.base", "utilities"} {
+		o.declare(name)
+	}
+	// declaring an existing layer again does not move it
+	o.declare("reset")
+
+	// lowest to highest priority
+	want := []string{"reset.base", "reset", "components.variants", "components", "utilities", ""}
+	for i := 1; i < len(want); i++ {
+		if o.get(want[i-1]) >= o.get(want[i]) {
+			t.Errorf("layer %q (%d) should have a lower priority than %q (%d)", want[i-1], o.get(want[i-1]), want[i], o.get(want[i]))
+		}
+	}
+
+	if o.get("not-declared") != o.get("") {
+		t.Errorf("unknown layers should be treated as unlayered")
+	}
+}
+
+func TestLayerOrderAnonymous(t *testing.T) {
+	sheet := `@layer { .a-1 { color: red; } } @layer base { @layer { .a-2 { color: red; } } }`
+	for i := 0; i < 2; i++ {
+		// the names do not depend on the stylesheets that were parsed before
+		r := NewMerger(nil, false)
+		for j := 0; j < 2; j++ {
+			if err := r.AddRules(strings.NewReader(sheet), false); err != nil {
+				t.Fatalf("AddRules returned error: %v", err)
+			}
+		}
+		got := make([]string, 0)
+		for _, class := range []string{"a-1", "a-2"} {
+			for _, rule := range r.rules.Load().rules[class] {
+				got = append(got, rule.GetLayer())
+			}
+		}
+		// the anonymous layers of the second stylesheet are not the ones of the first
+		want := []string{"<anonymous-1>", "<anonymous-3>", "base.<anonymous-2>", "base.<anonymous-4>"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Merger %d: got layers %q, want %q", i, got, want)
+		}
+	}
+}
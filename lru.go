@@ -0,0 +1,245 @@
+package merge
+
+import (
+	"hash/maphash"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LRUOptions are the limits of an LRUCache (see NewLRUCache).
+type LRUOptions struct {
+	MaxEntries int           // MaxEntries is the most entries the cache holds. Zero means no limit.
+	MaxBytes   int64         // MaxBytes is the most bytes of keys and values the cache holds. Zero means no limit.
+	TTL        time.Duration // TTL is how long an entry is used after it is set. Zero means entries do not expire.
+	Shards     int           // Shards is the number of parts of the cache that are locked on their own. Zero means 16.
+}
+
+// CacheStats are the counters of an LRUCache.
+type CacheStats struct {
+	Hits        uint64 // Hits is the number of Get calls that found a value
+	Misses      uint64 // Misses is the number of Get calls that found no value, including expired values
+	Evictions   uint64 // Evictions is the number of entries removed to stay within the limits
+	Expirations uint64 // Expirations is the number of entries removed because their TTL passed
+	Entries     int    // Entries is the number of entries in the cache
+	Bytes       int64  // Bytes is the size of the keys and values in the cache
+}
+
+// LRUCache is a bounded in-memory cache that evicts the least recently used entries.
+// It is safe for concurrent use. Unlike SimpleCache, its size does not grow with the number of different class lists,
+// so it can be used when the class lists come from users.
+//
+// The keys are spread over shards by their hash, and each shard is locked on its own.
+// The limits apply to the cache as a whole: when it is over a limit, the least recently used entry of all the shards is evicted,
+// so the cache holds MaxEntries entries whatever shards their keys are in. An entry larger than MaxBytes is not stored.
+// The size of an entry is the length of its key and value; the memory used to track entries is not counted.
+type LRUCache struct {
+	shards     []lruShard
+	mask       uint64
+	seed       maphash.Seed
+	ttl        time.Duration
+	maxEntries int64
+	maxBytes   int64
+	entries    atomic.Int64     // the number of entries in all the shards
+	bytes      atomic.Int64     // the size of the entries in all the shards
+	clock      atomic.Uint64    // ticks every time an entry is used, to compare recency across shards
+	now        func() time.Time // replaced in tests
+}
+
+// lruShard is a part of an LRUCache. Its entries are in a list from the most to the least recently used.
+type lruShard struct {
+	mu    sync.Mutex
+	items map[string]*lruEntry
+	head  lruEntry // sentinel: head.next is the most recently used entry and head.prev the least
+	bytes int64
+	stats CacheStats // the counters of the shard; Entries and Bytes are not kept up to date
+}
+
+type lruEntry struct {
+	key, value string
+	expires    time.Time
+	used       uint64 // the tick of the clock the entry was last used at
+	prev, next *lruEntry
+}
+
+// NewLRUCache creates a new LRUCache with the given limits.
+// A cache without limits grows like SimpleCache, but still tracks recency, so set at least one of MaxEntries or MaxBytes.
+func NewLRUCache(opts LRUOptions) *LRUCache {
+	n := opts.Shards
+	if n <= 0 {
+		n = 16
+	}
+	// the number of shards is rounded down to a power of two, so a shard is found with a mask
+	pow := 1
+	for pow*2 <= n {
+		pow *= 2
+	}
+	n = pow
+
+	c := &LRUCache{
+		shards:     make([]lruShard, n),
+		mask:       uint64(n - 1),
+		seed:       maphash.MakeSeed(),
+		ttl:        opts.TTL,
+		maxEntries: int64(opts.MaxEntries),
+		maxBytes:   opts.MaxBytes,
+		now:        time.Now,
+	}
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.items = make(map[string]*lruEntry)
+		s.head.next = &s.head
+		s.head.prev = &s.head
+	}
+	return c
+}
+
+// shard returns the shard of key.
+func (c *LRUCache) shard(key string) *lruShard {
+	return &c.shards[maphash.String(c.seed, key)&c.mask]
+}
+
+// Get returns the value for the given key, and a boolean indicating whether the key was found.
+// The entry becomes the most recently used.
+func (c *LRUCache) Get(key string) (string, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		s.stats.Misses++
+		return "", false
+	}
+	if c.ttl > 0 && c.now().After(e.expires) {
+		c.remove(s, e)
+		s.stats.Expirations++
+		s.stats.Misses++
+		return "", false
+	}
+	e.used = c.clock.Add(1)
+	s.moveToFront(e)
+	s.stats.Hits++
+	return e.value, true
+}
+
+// Set sets the value for the given key and makes it the most recently used entry.
+// The least recently used entries of the cache are evicted until it is within its limits.
+func (c *LRUCache) Set(key string, data string) {
+	size := int64(len(key) + len(data))
+	s := c.shard(key)
+	s.mu.Lock()
+	if e, ok := s.items[key]; ok {
+		c.remove(s, e)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		s.mu.Unlock()
+		return
+	}
+	e := &lruEntry{key: key, value: data, used: c.clock.Add(1)}
+	if c.ttl > 0 {
+		e.expires = c.now().Add(c.ttl)
+	}
+	s.items[key] = e
+	s.bytes += size
+	s.pushFront(e)
+	c.entries.Add(1)
+	c.bytes.Add(size)
+	s.mu.Unlock()
+
+	for c.over() {
+		if !c.evictOldest() {
+			break
+		}
+	}
+}
+
+// over returns whether the cache is over one of its limits.
+func (c *LRUCache) over() bool {
+	return (c.maxEntries > 0 && c.entries.Load() > c.maxEntries) || (c.maxBytes > 0 && c.bytes.Load() > c.maxBytes)
+}
+
+// evictOldest evicts the least recently used entry of the cache, and returns false if the cache is empty.
+// The shards are locked one at a time, so an entry used while they are compared may be evicted.
+func (c *LRUCache) evictOldest() bool {
+	var oldest *lruShard
+	used := uint64(math.MaxUint64)
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		if e := s.head.prev; e != &s.head && e.used < used {
+			oldest, used = s, e.used
+		}
+		s.mu.Unlock()
+	}
+	if oldest == nil {
+		return false
+	}
+	oldest.mu.Lock()
+	defer oldest.mu.Unlock()
+	if e := oldest.head.prev; e != &oldest.head {
+		c.remove(oldest, e)
+		oldest.stats.Evictions++
+	}
+	return true
+}
+
+// Clear removes all items from the cache. The counters are kept.
+func (c *LRUCache) Clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		c.entries.Add(-int64(len(s.items)))
+		c.bytes.Add(-s.bytes)
+		s.items = make(map[string]*lruEntry)
+		s.head.next = &s.head
+		s.head.prev = &s.head
+		s.bytes = 0
+		s.mu.Unlock()
+	}
+}
+
+// Stats returns the counters of the cache and its current size.
+func (c *LRUCache) Stats() CacheStats {
+	var stats CacheStats
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		stats.Hits += s.stats.Hits
+		stats.Misses += s.stats.Misses
+		stats.Evictions += s.stats.Evictions
+		stats.Expirations += s.stats.Expirations
+		stats.Entries += len(s.items)
+		stats.Bytes += s.bytes
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+func (s *lruShard) pushFront(e *lruEntry) {
+	e.prev = &s.head
+	e.next = s.head.next
+	e.next.prev = e
+	s.head.next = e
+}
+
+func (s *lruShard) moveToFront(e *lruEntry) {
+	if s.head.next == e {
+		return
+	}
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	s.pushFront(e)
+}
+
+// remove removes e from the shard s, which must be locked.
+func (c *LRUCache) remove(s *lruShard, e *lruEntry) {
+	size := int64(len(e.key) + len(e.value))
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+	delete(s.items, e.key)
+	s.bytes -= size
+	c.entries.Add(-1)
+	c.bytes.Add(-size)
+}
@@ -0,0 +1,203 @@
+package merge
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	cache := NewLRUCache(LRUOptions{MaxEntries: 2, Shards: 1})
+	cache.Set("key1", "data1")
+	cache.Set("key2", "data2")
+	cache.Get("key1") // key2 is now the least recently used
+	cache.Set("key3", "data3")
+
+	if _, ok := cache.Get("key2"); ok {
+		t.Errorf("Get returned true for the least recently used key")
+	}
+	for _, key := range []string{"key1", "key3"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Get returned false for %s", key)
+		}
+	}
+
+	// updating a key does not evict another one
+	cache.Set("key3", "updatedData")
+	if data, ok := cache.Get("key3"); !ok || data != "updatedData" {
+		t.Errorf("Get returned %s, %v, want updatedData, true", data, ok)
+	}
+
+	want := CacheStats{Hits: 4, Misses: 1, Evictions: 1, Entries: 2, Bytes: 24}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats returned %+v, want %+v", got, want)
+	}
+}
+
+func TestLRUCacheMaxBytes(t *testing.T) {
+	cache := NewLRUCache(LRUOptions{MaxBytes: 20, Shards: 1})
+	cache.Set("key1", "data1") // 9 bytes
+	cache.Set("key2", "data2")
+	cache.Set("key3", "data3") // evicts key1
+
+	if _, ok := cache.Get("key1"); ok {
+		t.Errorf("Get returned true for an evicted key")
+	}
+	if got := cache.Stats(); got.Bytes != 18 || got.Entries != 2 {
+		t.Errorf("Stats returned %+v, want 18 bytes in 2 entries", got)
+	}
+
+	// an entry larger than the limit is not stored
+	cache.Set("key4", "data that does not fit")
+	if _, ok := cache.Get("key4"); ok {
+		t.Errorf("Get returned true for an entry larger than the limit")
+	}
+	if got := cache.Stats(); got.Entries != 2 {
+		t.Errorf("Stats returned %d entries, want 2", got.Entries)
+	}
+}
+
+func TestLRUCacheDefaultShards(t *testing.T) {
+	// the limits apply to the whole cache, whatever shards the keys are in
+	cache := NewLRUCache(LRUOptions{MaxEntries: 10})
+	for i := 0; i < 10; i++ {
+		cache.Set("key"+strconv.Itoa(i), "data")
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := cache.Get("key" + strconv.Itoa(i)); !ok {
+			t.Errorf("Get returned false for key%d in a cache that is not full", i)
+		}
+	}
+	if got := cache.Stats(); got.Entries != 10 || got.Evictions != 0 {
+		t.Errorf("Stats returned %+v, want 10 entries and no evictions", got)
+	}
+
+	// key0 is the least recently used entry of all the shards
+	cache.Set("key10", "data")
+	if _, ok := cache.Get("key0"); ok {
+		t.Errorf("Get returned true for the least recently used key")
+	}
+	for i := 1; i <= 10; i++ {
+		if _, ok := cache.Get("key" + strconv.Itoa(i)); !ok {
+			t.Errorf("Get returned false for key%d", i)
+		}
+	}
+	if got := cache.Stats(); got.Entries != 10 || got.Evictions != 1 {
+		t.Errorf("Stats returned %+v, want 10 entries and 1 eviction", got)
+	}
+
+	// an entry larger than a sixteenth of the byte limit is stored if it fits the limit
+	cache = NewLRUCache(LRUOptions{MaxBytes: 64})
+	cache.Set("key", strings.Repeat("x", 40))
+	cache.Set("key2", "data2")
+	for _, key := range []string{"key", "key2"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Get returned false for %s", key)
+		}
+	}
+	if got := cache.Stats(); got.Bytes != 52 || got.Evictions != 0 {
+		t.Errorf("Stats returned %+v, want 52 bytes and no evictions", got)
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	now := time.Now()
+	cache := NewLRUCache(LRUOptions{MaxEntries: 10, TTL: time.Minute})
+	cache.now = func() time.Time { return now }
+
+	cache.Set("key1", "data1")
+	now = now.Add(30 * time.Second)
+	cache.Set("key2", "data2")
+	if _, ok := cache.Get("key1"); !ok {
+		t.Errorf("Get returned false before the TTL passed")
+	}
+
+	now = now.Add(45 * time.Second)
+	if _, ok := cache.Get("key1"); ok {
+		t.Errorf("Get returned true after the TTL passed")
+	}
+	if _, ok := cache.Get("key2"); !ok {
+		t.Errorf("Get returned false before the TTL passed")
+	}
+
+	want := CacheStats{Hits: 2, Misses: 1, Expirations: 1, Entries: 1, Bytes: 9}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats returned %+v, want %+v", got, want)
+	}
+}
+
+func TestLRUCacheClear(t *testing.T) {
+	cache := NewLRUCache(LRUOptions{MaxEntries: 100})
+	for i := 0; i < 50; i++ {
+		cache.Set("key"+strconv.Itoa(i), "data")
+	}
+	cache.Clear()
+
+	if _, ok := cache.Get("key1"); ok {
+		t.Errorf("Get returned true after clearing the cache")
+	}
+	if got := cache.Stats(); got.Entries != 0 || got.Bytes != 0 {
+		t.Errorf("Stats returned %+v, want an empty cache", got)
+	}
+	cache.Set("key1", "data1")
+	if _, ok := cache.Get("key1"); !ok {
+		t.Errorf("Get returned false after clearing the cache")
+	}
+}
+
+func TestLRUCacheConcurrent(t *testing.T) {
+	cache := NewLRUCache(LRUOptions{MaxEntries: 64, MaxBytes: 1 << 10})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa((g * i) % 200)
+				if data, ok := cache.Get(key); ok && data != "data"+key {
+					t.Errorf("Get returned %s for %s", data, key)
+				}
+				cache.Set(key, "data"+key)
+				if i%250 == 0 {
+					cache.Clear()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	got := cache.Stats()
+	if got.Entries > 64 || got.Bytes > 1<<10 {
+		t.Errorf("Stats returned %+v, want at most 64 entries and 1024 bytes", got)
+	}
+	if got.Hits+got.Misses != 8000 {
+		t.Errorf("Stats counted %d gets, want 8000", got.Hits+got.Misses)
+	}
+}
+
+func BenchmarkLRUCache(b *testing.B) {
+	keys := make([]string, 2000)
+	for i := range keys {
+		keys[i] = "p-" + strconv.Itoa(i) + " m-" + strconv.Itoa(i)
+	}
+
+	// with room for every key, almost every Get is a hit; with room for half of them, every Get misses and evicts
+	for _, maxEntries := range []int{4000, 1000} {
+		b.Run("MaxEntries="+strconv.Itoa(maxEntries), func(b *testing.B) {
+			cache := NewLRUCache(LRUOptions{MaxEntries: maxEntries})
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if _, ok := cache.Get(key); !ok {
+						cache.Set(key, key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"log"
 	"regexp"
 	"slices"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
 	"github.com/tylantz/go-tailwind-merge/internal/props"
@@ -22,12 +22,55 @@ type Cache interface {
 }
 
 // Merger is a struct that resolves conflicting css rules.
+// It is safe for concurrent use, including adding rules while merging.
 type Merger struct {
-	mu         sync.Mutex // mutex is only used when adding rules
-	rules      map[string]cascadia.CssRule
+	mu         sync.Mutex              // serializes AddRules
+	rules      atomic.Pointer[ruleSet] // the current rules, replaced as a whole by AddRules
 	cache      Cache
 	properties map[string]props.Property
 	keepSort   bool // keep the original sort order of the classes
+	// infer what classes that are not in the rules set from their Tailwind name (see SetTailwindFallback). Guarded by mu.
+	tailwindFallback bool
+	direction        Direction // the direction of the documents (see SetDirection). Guarded by mu.
+	pool             sync.Pool // resolutions reused by Merge
+}
+
+// ruleSet is a snapshot of the rules of a Merger and of what is precompiled from them.
+// It is never changed once it is in use: AddRules changes a copy of the current set and then replaces it,
+// so merges read the rules without a lock and a merge sees the same rules from start to end.
+type ruleSet struct {
+	rules      map[string][]cascadia.CssRule    // the rules of each class, in stylesheet order (see ruleClasses)
+	contexts   map[string][]cascadia.CssRule    // the rules each class is only context for (e.g., group in .group:hover .x), in stylesheet order
+	layers     *layerOrder                      // order of the cascade layers declared by the stylesheets
+	registered map[string]cascadia.PropertyRule // custom properties registered with @property
+	keys       keyTable                         // the properties and conditions set by the rules
+	footprints map[string]footprint             // what the rules of each class set, precompiled from rules
+	sources    []string                         // the names of the stylesheets that were loaded, in load order
+	fallback   *tailwindFallback                // nil unless the Tailwind fallback is enabled (see SetTailwindFallback)
+	direction  Direction                        // the direction the footprints are compiled for (see SetDirection)
+}
+
+// clone returns a copy of the rule set that can be changed without changing rs.
+// The footprints are not copied because they are compiled again (see compile).
+func (rs *ruleSet) clone() *ruleSet {
+	next := &ruleSet{
+		rules:      make(map[string][]cascadia.CssRule, len(rs.rules)),
+		contexts:   make(map[string][]cascadia.CssRule, len(rs.contexts)),
+		layers:     rs.layers.clone(),
+		registered: make(map[string]cascadia.PropertyRule, len(rs.registered)),
+		sources:    slices.Clip(rs.sources),
+	}
+	for class, rules := range rs.rules {
+		// clipped so that appending to the copy does not write to the array of rs
+		next.rules[class] = slices.Clip(rules)
+	}
+	for class, rules := range rs.contexts {
+		next.contexts[class] = slices.Clip(rules)
+	}
+	for name, prop := range rs.registered {
+		next.registered[name] = prop
+	}
+	return next
 }
 
 // NewMerger creates a new instance of Merger.
@@ -41,17 +84,41 @@ func NewMerger(cache Cache, keepSort bool) *Merger {
 		log.Fatal(err)
 	}
 
-	return &Merger{
-		rules:      make(map[string]cascadia.CssRule),
+	r := &Merger{
 		cache:      cache,
 		properties: p,
 		keepSort:   keepSort,
 	}
+	r.rules.Store(newRuleSet())
+	return r
+}
+
+// newRuleSet returns an empty rule set.
+func newRuleSet() *ruleSet {
+	return &ruleSet{
+		rules:      make(map[string][]cascadia.CssRule),
+		contexts:   make(map[string][]cascadia.CssRule),
+		layers:     newLayerOrder(),
+		registered: make(map[string]cascadia.PropertyRule),
+		keys:       newKeyTable(),
+		footprints: make(map[string]footprint),
+	}
 }
 
-// Rules returns the map of css class rules with class names as keys and CssRule structs as values
-func (r *Merger) Rules() map[string]cascadia.CssRule {
-	return r.rules
+// Rules returns the map of css class rules with class names as keys and the CssRule structs of the class as values.
+// A rule belongs to the classes of the element it applies to, not to the classes it only uses as context
+// (e.g., .group:hover .x belongs to x, not to group).
+// The rules for a class are in the order they were added.
+// The map is shared with the Merger and must not be changed.
+func (r *Merger) Rules() map[string][]cascadia.CssRule {
+	return r.rules.Load().rules
+}
+
+// RegisteredProperties returns the custom properties registered with @property, with the property name as key.
+// A later registration of the same property replaces an earlier one.
+// The map is shared with the Merger and must not be changed.
+func (r *Merger) RegisteredProperties() map[string]cascadia.PropertyRule {
+	return r.rules.Load().registered
 }
 
 // walk recursively walks a selector and returns a slice of component selectors.
@@ -85,50 +152,172 @@ func walk(selector cascadia.Sel) []cascadia.Sel {
 	return selectors
 }
 
+// ruleClasses returns the classes a rule is indexed under (see ruleOwner).
+func ruleClasses(sel cascadia.Sel) []string {
+	_, classes, _ := ruleOwner(sel)
+	return classes
+}
+
+// ruleOwner returns the classes that own a rule, and the part of its selector that matches the element with these classes.
+// The owner is the subject of the selector, which is the rightmost compound selector,
+// so the classes of the elements the subject is related to (e.g., group in .group:hover .x or peer in .peer:checked ~ .x)
+// are part of the condition of the rule instead. A subject without a class belongs to the nearest compound selector
+// with classes to its left, and styled is how the elements the rule styles are related to it
+// (e.g., space-x-2 owns .space-x-2 > :not([hidden]) ~ :not([hidden]), and styled is "> :not([hidden]) ~ :not([hidden])").
+// A selector that is only :is() or :where() with a single selector is owned like that selector
+// (e.g., :where(.space-x-2 > :not(:last-child)) in Tailwind v4).
+func ruleOwner(sel cascadia.Sel) (owner cascadia.Sel, classes []string, styled string) {
+	if inner, ok := onlyMatchesAny(sel); ok {
+		return ruleOwner(inner)
+	}
+	if t, ok := sel.(cascadia.CombinedSelector); ok {
+		if t.Second() == nil {
+			return ruleOwner(t.First())
+		}
+		if classes := compoundClasses(t.Second()); len(classes) > 0 {
+			return sel, classes, ""
+		}
+		owner, classes, styled := ruleOwner(t.First())
+		if t.Combinator() != ' ' {
+			styled += " " + string(t.Combinator())
+		}
+		return owner, classes, strings.TrimSpace(styled + " " + normalizeSelector("", t.Second()))
+	}
+	return sel, compoundClasses(sel), ""
+}
+
+// onlyMatchesAny returns A if sel is :is(A) or :where(A), alone or as the only simple selector of a compound selector.
+func onlyMatchesAny(sel cascadia.Sel) (cascadia.Sel, bool) {
+	var selectors []cascadia.Sel
+	switch t := sel.(type) {
+	case cascadia.IsPseudoClassSelector:
+		selectors = t.Selectors()
+	case cascadia.WherePseudoClassSelector:
+		selectors = t.Selectors()
+	case cascadia.CompoundSelector:
+		if s := t.Selectors(); len(s) == 1 && t.PseudoElement() == "" {
+			return onlyMatchesAny(s[0])
+		}
+	}
+	if len(selectors) != 1 {
+		return nil, false
+	}
+	return selectors[0], true
+}
+
+// compoundClasses returns the classes of a compound selector.
+// The classes in :is() and :where() are only used if the compound selector has no class of its own
+// (e.g., a and b for :is(.a, .b), but only x for .x:where(.dark, .dark *)).
+func compoundClasses(sel cascadia.Sel) []string {
+	switch t := sel.(type) {
+	case cascadia.ClassSelector:
+		return []string{t.Class}
+	case cascadia.CompoundSelector:
+		var classes, matchesAny []string
+		for _, s := range t.Selectors() {
+			switch s.(type) {
+			case cascadia.ClassSelector:
+				classes = append(classes, compoundClasses(s)...)
+			case cascadia.IsPseudoClassSelector, cascadia.WherePseudoClassSelector:
+				matchesAny = append(matchesAny, compoundClasses(s)...)
+			}
+		}
+		if len(classes) == 0 {
+			return matchesAny
+		}
+		return classes
+	case cascadia.IsPseudoClassSelector:
+		return matchesAnyClasses(t.Selectors())
+	case cascadia.WherePseudoClassSelector:
+		return matchesAnyClasses(t.Selectors())
+	}
+	return nil
+}
+
+// matchesAnyClasses returns the classes of the selectors of :is() or :where().
+func matchesAnyClasses(selectors []cascadia.Sel) []string {
+	var classes []string
+	for _, s := range selectors {
+		classes = append(classes, ruleClasses(s)...)
+	}
+	return classes
+}
+
 // AddRules adds rules to the Merger from a reader.
 // It takes a reader and a boolean value indicating whether the rules are inline.
 // Returns an error if the rules could not be parsed.
-// If the cache is not nil, it is cleared.
-// New rules with the same class will overwrite existing rules.
+// The stylesheet is parsed before anything is changed, so the Merger keeps its rules and its cache if it fails.
+// Otherwise the new rules are used by every merge that starts after AddRules returns,
+// and the cache is cleared if it is not nil.
+// New rules with the same class are added alongside the existing rules for that class.
+// Cascade layers declared by the stylesheet are appended to the layer order of the Merger.
+// Custom properties registered with @property are kept (see RegisteredProperties).
 func (r *Merger) AddRules(reader io.Reader, inline bool) error {
+	sheet, err := cascadia.ExtractStylesheet(reader, inline)
+	if err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if r.cache != nil {
-		r.cache.Clear()
+	next := r.rules.Load().clone()
+	next.add(sheet)
+	r.publish(next)
+	return nil
+}
+
+// add adds the rules, layers and registered custom properties of a stylesheet to a rule set that is not in use yet.
+func (rs *ruleSet) add(sheet cascadia.Stylesheet) {
+	rs.layers.renameAnonymous(&sheet)
+	for _, layer := range sheet.Layers {
+		rs.layers.declare(layer)
 	}
-	rules, err := cascadia.ExtractRules(reader, inline)
-	if err != nil {
-		return err
+	for _, prop := range sheet.Properties {
+		rs.registered[prop.Name] = prop
 	}
-	for _, rule := range rules {
-		selectors := walk(rule.Selector)
-		for _, selector := range selectors {
-			if t, ok := selector.(cascadia.ClassSelector); ok {
-				r.rules[t.Class] = rule
+	for _, rule := range sheet.Rules {
+		added := make(map[string]bool) // a class can be used more than once in a selector (e.g., .a.a)
+		for _, class := range ruleClasses(rule.Selector) {
+			if !added[class] {
+				rs.rules[class] = append(rs.rules[class], rule)
+				added[class] = true
+			}
+		}
+		for _, selector := range walk(rule.Selector) {
+			if t, ok := selector.(cascadia.ClassSelector); ok && !added[t.Class] {
+				rs.contexts[t.Class] = append(rs.contexts[t.Class], rule)
+				added[t.Class] = true
 			}
 		}
+	}
+}
 
+// publish compiles a rule set and makes it the current rule set. The cache is cleared once it is in use.
+// r.mu must be held.
+func (r *Merger) publish(next *ruleSet) {
+	r.compile(next)
+	r.rules.Store(next)
+	if r.cache != nil {
+		r.cache.Clear()
 	}
-	return nil
 }
 
-func (r *Merger) getAffectedProps(rule cascadia.CssRule) []string {
-	affectedProps := make([]string, 0, len(rule.Declarations)*4) // 4 is arbitrary. reducing allocations
-	for _, dec := range rule.Declarations {
-		prop, ok := r.properties[dec.Property]
-		if !ok {
-			// Allowing these through, maybe they shouldn't be but
-			// this allows properties like stroke, fill, etc. to be used
-			// which are not in the mdn official list of props
-			// IMPORTANT: we are relying on this to let custom properties through
-			affectedProps = append(affectedProps, dec.Property)
-		}
-		affectedProps = append(affectedProps, prop.ComputedProps()...)
+// appendDeclarationProps appends the properties a declaration sets to affectedProps.
+// A shorthand property sets all the properties it is computed to,
+// and logical properties are related to physical properties for the direction (see SetDirection).
+func (r *Merger) appendDeclarationProps(affectedProps []string, dec cascadia.CssDeclaration, dir Direction) []string {
+	prop, ok := r.properties[dec.Property]
+	computed := prop.ComputedProps()
+	if !ok {
+		// Allowing these through, maybe they shouldn't be but
+		// this allows properties like stroke, fill, etc. to be used
+		// which are not in the mdn official list of props
+		// IMPORTANT: we are relying on this to let custom properties through
+		computed = []string{dec.Property}
 	}
-	return unique(affectedProps)
+	return append(affectedProps, props.ResolveLogical(computed, dir.propsDirection())...)
 }
 
-var importantRegex = regexp.MustCompile(`!important`)      // matches !important in a css declaration value
 var customVarRegex = regexp.MustCompile(`var\((--[\w-]+)`) // matches custom variables in a css declaration value
 
 func getCustomVarsInDec(dec cascadia.CssDeclaration) []string {
@@ -146,59 +335,23 @@ func getCustomVarsInDec(dec cascadia.CssDeclaration) []string {
 	return vars
 }
 
-// classWithPseudo checks if a selector is a compound selector
-// with a class and one or more pseudo element or class.
-// It returns true if the selector is a class with pseudo elements or classes.
-func classWithPseudo(sel cascadia.Sel) bool {
-	_, ok := sel.(cascadia.CompoundSelector)
-	if !ok {
-		return false
-	}
-	selectors := walk(sel)
-	for i, s := range selectors {
-		if i == 0 {
-			_, firstIsClass := s.(cascadia.ClassSelector)
-			if !firstIsClass {
-				return false
-			}
-			continue
-		}
-		ok := cascadia.IsPseudoElement(s)
-		if !ok {
-			return false
-		}
-	}
-	return true
-}
-
-func isClass(sel cascadia.Sel) bool {
-	if _, ok := sel.(cascadia.ClassSelector); ok {
-		return true
-	}
-	return false
-}
-
-// propModifier returns a string representing the circumstance in which the class applies.
-// This may be pseudo elements like hover, focus, etc. or, in the case of a combination selector,
-// it can be the selector with the class name removed
-func propModifier(class string, rule cascadia.CssRule) string {
-	if isClass(rule.Selector) || classWithPseudo(rule.Selector) {
-		// if the rule has a condition (:hover, :focus, etc.), add the condition to the property name
-		return rule.GetCondition()
-	} else {
-		// use the selector with the class name removed to codify what the selector is being applied to
-		s := cascadia.CssUnescape([]byte(rule.Selector.String()))
-		return strings.Replace(s, class, "", 1)
-	}
+// atRuleCondition returns the condition of the chain of at-rules a rule is nested in, in a normal form (see Condition.AtRules).
+func atRuleCondition(rule cascadia.CssRule) string {
+	return strings.Join(normalizeAtRules(rule.GetAtRules()), " and ")
 }
 
 // Merge resolves conflicting css class rules.
 // It takes a string of space-separated class names.
 // Returns a string of space-separated class names with the conflicting classes removed.
-// It prioritises the last class in the list for each property.
+// It prioritises the last class in the list for each property,
+// unless an earlier class sets the property from a cascade layer with a higher priority,
+// or from a selector with a higher specificity under the same condition (e.g., .a.a beats a later .b).
+// A later class that cannot win any property is removed.
 // If a class name is not found in the rules, it is kept in the output.
-// Important properties are prioritised over non-important properties.
+// Important properties are prioritised over non-important properties, and the priority of layers is reversed for them,
+// so a class with an !important property removes an earlier or later class that only sets it without !important.
 // If the cache is not nil, it will store the result of the merge to skip re-calculating the merge later.
+// See Explain to find out why a class was kept or dropped.
 func (r *Merger) Merge(inClass string) string {
 	if r.cache != nil {
 		val, ok := r.cache.Get(inClass)
@@ -206,99 +359,229 @@ func (r *Merger) Merge(inClass string) string {
 			return val
 		}
 	}
-	split := strings.Split(strings.TrimSpace(inClass), " ")
-	if len(split) < 2 {
+	rs := r.rules.Load()
+	res := r.getResolution(rs)
+	defer r.putResolution(res)
+	res.split = splitClasses(res.split, inClass)
+	if len(res.split) < 2 {
 		return inClass
 	}
 
-	keepClasses := make([]string, 0, len(split))
-	selectorToClass := make(map[string]string, len(split))
-
-	// propsToClasses is a map of properties that are shared between classes
-	// The property name may have a condition (pseudo or media) appended to it (e.g., "height:hover": ["h-10", "h-20"])
-	propsToSelectors := make(map[string]string, len(split))
-	importantPropsToSelectors := make(map[string]string, len(split))
-	customVarsToSelectors := make(map[string]string, len(split)) // map of custom vars to the class that set them
-	propsToCustomVars := make(map[string][]string, len(split))   // map of props to the custom vars that it uses
-	for _, class := range split {
-		rule, ok := r.rules[class]
-		if !ok {
-			// log.Println("rule not found for class:", class)
-			keepClasses = append(keepClasses, class)
-			continue
+	rs.resolve(res)
+	out := r.join(res.split, res.keep())
+	if r.cache != nil {
+		r.cache.Set(inClass, out)
+		if r.rules.Load() != rs {
+			// the rules were replaced during the merge, so the cache may have been cleared before the result was set
+			r.cache.Clear()
 		}
+	}
+	return out
+}
 
-		selectorToClass[rule.Selector.String()] = class
-		propMod := propModifier(class, rule)
-
-		for _, prop := range r.getAffectedProps(rule) {
+// splitClasses appends the classes of a class string to dst.
+func splitClasses(dst []string, inClass string) []string {
+	s := strings.TrimSpace(inClass)
+	for {
+		i := strings.IndexByte(s, ' ')
+		if i < 0 {
+			return append(dst, s)
+		}
+		dst = append(dst, s[:i])
+		s = s[i+1:]
+	}
+}
 
-			prop = prop + propMod
+// join returns the classes that are kept as a space-separated string.
+func (r *Merger) join(split []string, keepClasses []string) string {
+	if r.keepSort {
+		sortSubset(keepClasses, split)
+	}
+	return strings.Join(keepClasses, " ")
+}
 
-			for _, dec := range rule.Declarations {
+// resolution is the outcome of resolving the footprints of a list of classes.
+// Resolutions are reused between merges (see getResolution), so resolving only allocates
+// when a merge needs more room than the merges before it.
+type resolution struct {
+	split   []string // the input classes
+	unknown []string // classes without rules
+	kept    []string // the classes that are kept (see keep)
 
-				if !strings.HasPrefix(prop, "--") {
-					// if the property has a custom var, add it to the propsToCustomVars map
-					customVars := getCustomVarsInDec(dec)
-					// overwrite the customVars so we prioritize the last class that sets the property
-					propsToCustomVars[prop] = customVars
-				}
+	entries []keyResolution // the outcome of each property and condition set by the classes
+	slots   []int32         // the index+1 in entries of each key of the keyTable, 0 if no class sets it
 
-				// if the property is marked !important, add the class to the importantProps map
-				if importantRegex.MatchString(dec.Value) {
-					importantPropsToSelectors[prop] = rule.Selector.String()
-				}
-			}
+	inferred  map[string]footprint // the footprints inferred for classes that are not in the rules (see SetTailwindFallback)
+	extraKeys []propertyKey        // the keys of inferred footprints that are not in the keyTable (see keyID)
+	pending   []int                // the custom properties left to mark as used (see resolve)
+}
 
-			// if it has a custom prop, add it to the customVars map
-			if strings.HasPrefix(prop, "--") {
-				customVarsToSelectors[prop] = rule.Selector.String()
-				continue
-			}
+// keyResolution is the outcome of a property set under a condition.
+type keyResolution struct {
+	key         int
+	custom      bool                 // the property is a custom property
+	layer       int                  // the layer rank of the class that set it
+	specificity cascadia.Specificity // the specificity of the rule that set it
+	important   bool                 // the winner sets it with !important
+	winner      string               // the class that wins it in the cascade (see classSetting.overrides)
+	uses        []int                // the custom properties used by the value of the winner
+	used        bool                 // a kept property uses the custom property, directly or through other custom properties
+}
 
-			// add all classes to the propsToClasses map
-			propsToSelectors[prop] = rule.Selector.String()
-		}
+// getResolution returns an empty resolution with room for every key of a rule set.
+func (r *Merger) getResolution(rs *ruleSet) *resolution {
+	res, _ := r.pool.Get().(*resolution)
+	if res == nil {
+		res = &resolution{}
+	}
+	if n := len(rs.keys.keys); len(res.slots) < n {
+		res.slots = make([]int32, n)
 	}
+	return res
+}
 
-	// keep the last class in the list for each property
-	// importantly, this keeps classes that uniquely define a property, even if it has properties that conflict with other classes
-	for _, sel := range propsToSelectors {
-		class := selectorToClass[sel]
-		keepClasses = append(keepClasses, class)
+// putResolution empties a resolution and returns it to the pool.
+func (r *Merger) putResolution(res *resolution) {
+	for i := range res.entries {
+		res.slots[res.entries[i].key] = 0
+		res.entries[i] = keyResolution{}
+	}
+	res.entries = res.entries[:0]
+	for i := range res.split {
+		res.split[i] = ""
 	}
+	res.split = res.split[:0]
+	res.unknown = res.unknown[:0]
+	res.kept = res.kept[:0]
+	res.inferred = nil
+	res.extraKeys = res.extraKeys[:0]
+	res.pending = res.pending[:0]
+	r.pool.Put(res)
+}
 
-	// If a class has an !important property, it is kept unless another class comes later in the class string and it is marked !important on the same property.
-	for _, sel := range importantPropsToSelectors {
-		// This does not remove the class that the the important class is overriding,
-		// but it shouldn't matter because the important class will override the other,
-		// and the other class may have other properties that are not being overridden
-		class := selectorToClass[sel]
-		keepClasses = append(keepClasses, class)
+// entry returns the outcome of a key, and whether a class set it before.
+// The pointer is only valid until the next call.
+func (res *resolution) entry(key int) (*keyResolution, bool) {
+	if i := res.slots[key]; i != 0 {
+		return &res.entries[i-1], true
 	}
+	res.entries = append(res.entries, keyResolution{key: key})
+	res.slots[key] = int32(len(res.entries))
+	return &res.entries[len(res.entries)-1], false
+}
 
-	// keep the class that sets the last definition of each custom property if that custom property is actually used
-	for custVar, sel := range customVarsToSelectors {
-		for _, vars := range propsToCustomVars {
-			// if the custom property is actually used, keep the class that sets it
-			if !slices.Contains(vars, custVar) {
+// resolve finds the class that wins each property set by the classes of res.split.
+func (rs *ruleSet) resolve(res *resolution) {
+	for _, class := range res.split {
+		fp, ok := rs.footprint(res, class)
+		if !ok {
+			// log.Println("rule not found for class:", class)
+			res.unknown = append(res.unknown, class)
+			continue
+		}
+
+		// a class may be used in many rules (e.g., .btn, .btn:hover, @media ... .btn)
+		// each rule competes with the rules of other classes under the same condition
+		for i := range fp {
+			s := &fp[i]
+			e, ok := res.entry(s.key)
+			if ok && !s.overrides(e) {
 				continue
 			}
-			class := selectorToClass[sel]
-			keepClasses = append(keepClasses, class)
-			break
+			e.winner = class
+			e.important = s.important
+			e.layer = s.layer
+			e.specificity = s.specificity
+			e.custom = s.custom
+			// overwrite the custom vars so we prioritize the last class that sets the property
+			e.uses = s.uses
 		}
 	}
 
-	keepClasses = unique(keepClasses)
-	if r.keepSort {
-		sortSubset(keepClasses, split)
+	// a custom property is used if the winner of a property uses it, or if the winner of a used custom property uses it
+	// (e.g., box-shadow uses --tw-ring-shadow, which uses --tw-ring-color).
+	// It is used whatever the condition it is set in, because it changes the value of the property in that condition.
+	for i := range res.entries {
+		if !res.entries[i].custom {
+			res.pending = append(res.pending, res.entries[i].uses...)
+		}
 	}
-	out := strings.Join(keepClasses, " ")
-	if r.cache != nil {
-		r.cache.Set(inClass, out)
+	for len(res.pending) > 0 {
+		v := res.pending[len(res.pending)-1]
+		res.pending = res.pending[:len(res.pending)-1]
+		for i := range res.entries {
+			e := &res.entries[i]
+			if e.custom && !e.used && rs.key(res, e.key).variable == v {
+				e.used = true
+				res.pending = append(res.pending, e.uses...)
+			}
+		}
 	}
-	return out
+}
+
+// overrides returns whether s wins over the setting that won e, as the setting of a later class in the class string.
+// The later class wins a tie in the cascade (see cascadeRank.compare).
+func (s *classSetting) overrides(e *keyResolution) bool {
+	return s.rank().compare(e.rank()) >= 0
+}
+
+func (s *classSetting) rank() cascadeRank {
+	return cascadeRank{important: s.important, layer: s.layer, specificity: s.specificity}
+}
+
+func (e *keyResolution) rank() cascadeRank {
+	return cascadeRank{important: e.important, layer: e.layer, specificity: e.specificity}
+}
+
+// cascadeRank is what decides between two declarations of a property in the cascade, apart from their order.
+// Merge and MergeNode both use it, and break a tie with the order of the classes.
+type cascadeRank struct {
+	important   bool // the declaration is !important
+	layer       int  // the layer rank of the rule (see layerOrder)
+	specificity cascadia.Specificity
+}
+
+// compare returns a positive number if c wins over o, a negative number if o wins over c, and 0 for a tie.
+// It follows the cascade: an !important declaration wins over a normal one, then a declaration in a layer with a higher priority
+// (the order of the layers is reversed for !important declarations, so unlayered rules lose to every layer),
+// then a declaration with a more specific selector.
+func (c cascadeRank) compare(o cascadeRank) int {
+	switch {
+	case c.important != o.important:
+		if c.important {
+			return 1
+		}
+		return -1
+	case c.layer != o.layer:
+		if c.layer > o.layer != c.important {
+			return 1
+		}
+		return -1
+	case o.specificity.Less(c.specificity):
+		return 1
+	case c.specificity.Less(o.specificity):
+		return -1
+	}
+	return 0
+}
+
+// keep returns the classes that are kept, without duplicates and sorted.
+// The slice is only valid until the resolution is returned to the pool.
+func (res *resolution) keep() []string {
+	keepClasses := append(res.kept[:0], res.unknown...)
+
+	for i := range res.entries {
+		e := &res.entries[i]
+		// keep the last class in the list for each property
+		// importantly, this keeps classes that uniquely define a property, even if it has properties that conflict with other classes.
+		// The class that sets the last definition of each custom property is only kept if that custom property is actually used.
+		if e.winner != "" && (!e.custom || e.used) {
+			keepClasses = append(keepClasses, e.winner)
+		}
+	}
+
+	res.kept = unique(keepClasses)
+	return res.kept
 }
 
 // unique returns a slice with all duplicate elements removed.
@@ -313,17 +596,22 @@ func unique[S ~[]E, E cmp.Ordered](x S) S {
 // sortSubset sorts a subset of strings based on the order of the full set of strings.
 // if duplicates are present in the full, this function takes the final position for a value (left-to-right).
 func sortSubset(sub []string, full []string) {
-	indexMap := make(map[string]int, len(full))
-	for i, v := range full {
-		indexMap[v] = i
-	}
-
-	// Sort subset based on the indices in indexMap
-	sort.Slice(sub, func(i, j int) bool {
-		return indexMap[sub[i]] < indexMap[sub[j]]
+	slices.SortStableFunc(sub, func(a, b string) int {
+		return cmp.Compare(lastIndex(full, a), lastIndex(full, b))
 	})
 }
 
+// lastIndex returns the index of the last occurrence of v in s, or 0 if v is not in s.
+// It is a linear search, which is faster than a map for the length of a class list.
+func lastIndex(s []string, v string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == v {
+			return i
+		}
+	}
+	return 0
+}
+
 /*
 The CSS properties that can accept multiple values and layer them, rather than overriding them, are:
 
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"os"
 	"slices"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -145,622 +147,1686 @@ func BenchmarkMergeCache(b *testing.B) {
 	}
 }
 
+func BenchmarkMergeLRUCache(b *testing.B) {
+	by, err := os.ReadFile("./internal/cascadia/test_resources/test_output.css")
+	if err != nil {
+		b.Fatalf("ReadFile returned error: %v", err)
+	}
+	cache := NewLRUCache(LRUOptions{MaxEntries: 1000})
+	rm := NewMerger(cache, false)
+	err = rm.AddRules(bytes.NewBuffer(by), false)
+	if err != nil {
+		b.Fatalf("AddRules returned error: %v", err)
+	}
+
+	by, err = os.ReadFile("./internal/cascadia/test_resources/classList.txt")
+	if err != nil {
+		b.Fatalf("ReadFile returned error: %v", err)
+	}
+	classList := string(by)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rm.Merge(classList)
+	}
+}
+
+// mergeTests is the tailwind-merge test corpus (see scripts/twMergeTests).
+// It is run against the stylesheets generated by Tailwind v3 and v4.
+var mergeTests = []struct {
+	in   string
+	want string
+}{
+	// color variants
+	{
+		in:   "border-white border-white/10",
+		want: "border-white/10",
+	},
+	{
+		in:   "border-white/10 border-white",
+		want: "border-white",
+	},
+	// handles arbitrary property conflicts correctly
+	{
+		in:   "[paint-order:markers] [paint-order:normal]",
+		want: "[paint-order:normal]",
+	},
+	// handles arbitrary property conflicts with modifiers correctly
+	{
+		in:   "[paint-order:markers] hover:[paint-order:normal]",
+		want: "[paint-order:markers] hover:[paint-order:normal]",
+	},
+	{
+		in:   "hover:[paint-order:markers] hover:[paint-order:normal]",
+		want: "hover:[paint-order:normal]",
+	},
+	{
+		in:   "hover:focus:[paint-order:markers] focus:hover:[paint-order:normal]",
+		want: "focus:hover:[paint-order:normal]",
+	},
+	// handles simple conflicts with arbitrary values correctly
+	{
+		in:   "m-[2px] m-[10px]",
+		want: "m-[10px]",
+	},
+	{
+		in:   "z-20 z-[99]",
+		want: "z-[99]",
+	},
+	{
+		in:   "my-[2px] m-[10rem]",
+		want: "m-[10rem]",
+	},
+	{
+		in:   "cursor-pointer cursor-[grab]",
+		want: "cursor-[grab]",
+	},
+	{
+		in:   "m-[calc(100%-var(--arbitrary))] m-[2px]",
+		want: "m-[2px]",
+	},
+	{
+		in:   "m-[2px] m-[length:var(--mystery-var)]",
+		want: "m-[length:var(--mystery-var)]",
+	},
+	{
+		in:   "opacity-10 opacity-[0.025]",
+		want: "opacity-[0.025]",
+	},
+	{
+		in:   "scale-75 scale-[1.7]",
+		want: "scale-[1.7]",
+	},
+	{
+		in:   "brightness-90 brightness-[1.75]",
+		want: "brightness-[1.75]",
+	},
+	{
+		in:   "min-h-[0.5px] min-h-[0]",
+		want: "min-h-[0]",
+	},
+	{
+		in:   "text-[0.5px] text-[color:0]",
+		want: "text-[0.5px] text-[color:0]",
+	},
+	{
+		in:   "text-[0.5px] text-[--my-0]",
+		want: "text-[0.5px] text-[--my-0]",
+	},
+	// handles arbitrary length conflicts with labels and modifiers correctly
+	{
+		in:   "hover:m-[2px] hover:m-[length:var(--c)]",
+		want: "hover:m-[length:var(--c)]",
+	},
+	{
+		in:   "hover:focus:m-[2px] focus:hover:m-[length:var(--c)]",
+		want: "focus:hover:m-[length:var(--c)]",
+	},
+	// handles complex arbitrary value conflicts correctly
+	{
+		in:   "grid-rows-[1fr,auto] grid-rows-2",
+		want: "grid-rows-2",
+	},
+	{
+		in:   "grid-rows-[repeat(20,minmax(0,1fr))] grid-rows-3",
+		want: "grid-rows-3",
+	},
+	// handles ambiguous arbitrary values correctly
+	{
+		in:   "mt-2 mt-[calc(theme(fontSize.4xl)/1.125)]",
+		want: "mt-[calc(theme(fontSize.4xl)/1.125)]",
+	},
+	{
+		in:   "p-2 p-[calc(theme(fontSize.4xl)/1.125)_10px]",
+		want: "p-[calc(theme(fontSize.4xl)/1.125)_10px]",
+	},
+	{
+		in:   "bg-cover bg-[percentage:30%] bg-[length:200px_100px]",
+		want: "bg-[length:200px_100px]",
+	},
+	// basic arbitrary variants
+	{
+		in:   "[&>*]:underline [&>*]:line-through",
+		want: "[&>*]:line-through",
+	},
+	{
+		in:   "[&>*]:underline [&>*]:line-through [&_div]:line-through",
+		want: "[&>*]:line-through [&_div]:line-through",
+	},
+	{
+		in:   "supports-[display:grid]:flex supports-[display:grid]:grid",
+		want: "supports-[display:grid]:grid",
+	},
+	// arbitrary variants with modifiers
+	{
+		in:   "dark:lg:hover:[&>*]:underline dark:lg:hover:[&>*]:line-through",
+		want: "dark:lg:hover:[&>*]:line-through",
+	},
+	{
+		in:   "dark:lg:hover:[&>*]:underline dark:hover:lg:[&>*]:line-through",
+		want: "dark:hover:lg:[&>*]:line-through",
+	},
+	{
+		in:   "hover:[&>*]:underline [&>*]:hover:line-through",
+		want: "hover:[&>*]:underline [&>*]:hover:line-through",
+	},
+	// arbitrary variants with attribute selectors
+	{
+		in:   "[&[data-open]]:underline [&[data-open]]:line-through",
+		want: "[&[data-open]]:line-through",
+	},
+	// multiple arbitrary variants
+	{
+		in:   "[&>*]:[&_div]:underline [&>*]:[&_div]:line-through",
+		want: "[&>*]:[&_div]:line-through",
+	},
+	{
+		in:   "[&>*]:[&_div]:underline [&_div]:[&>*]:line-through",
+		want: "[&>*]:[&_div]:underline [&_div]:[&>*]:line-through",
+	},
+	// arbitrary variants with arbitrary properties
+	{
+		in:   "[&>*]:[color:red] [&>*]:[color:blue]",
+		want: "[&>*]:[color:blue]",
+	},
+	// merges classes from same group correctly
+	{
+		in:   "overflow-x-auto overflow-x-hidden",
+		want: "overflow-x-hidden",
+	},
+	{
+		in:   "basis-full basis-auto",
+		want: "basis-auto",
+	},
+	{
+		in:   "w-full w-fit",
+		want: "w-fit",
+	},
+	{
+		in:   "overflow-x-auto overflow-x-hidden overflow-x-scroll",
+		want: "overflow-x-scroll",
+	},
+	{
+		in:   "overflow-x-auto hover:overflow-x-hidden overflow-x-scroll",
+		want: "hover:overflow-x-hidden overflow-x-scroll",
+	},
+	{
+		in:   "col-span-1 col-span-full",
+		want: "col-span-full",
+	},
+	// merges classes from Font Variant Numeric section correctly
+	{
+		in:   "lining-nums tabular-nums diagonal-fractions",
+		want: "lining-nums tabular-nums diagonal-fractions",
+	},
+	{
+		in:   "normal-nums tabular-nums diagonal-fractions",
+		want: "tabular-nums diagonal-fractions",
+	},
+	{
+		in:   "tabular-nums diagonal-fractions normal-nums",
+		want: "normal-nums",
+	},
+	{
+		in:   "tabular-nums proportional-nums",
+		want: "proportional-nums",
+	},
+	// handles color conflicts properly
+	{
+		in:   "hover:bg-destructive/90 hover:bg-accent",
+		want: "hover:bg-accent",
+	},
+	{
+		in:   "stroke-[hsl(350_80%_0%)] stroke-[10px]",
+		want: "stroke-[hsl(350_80%_0%)] stroke-[10px]",
+	},
+	// handles conflicts across class groups correctly
+	{
+		in:   "inset-1 inset-x-1",
+		want: "inset-1 inset-x-1",
+	},
+	{
+		in:   "inset-x-1 inset-1",
+		want: "inset-1",
+	},
+	{
+		in:   "inset-x-1 left-1 inset-1",
+		want: "inset-1",
+	},
+	{
+		in:   "inset-x-1 inset-1 left-1",
+		want: "inset-1 left-1",
+	},
+	{
+		in:   "inset-x-1 right-1 inset-1",
+		want: "inset-1",
+	},
+	{
+		in:   "inset-x-1 right-1 inset-x-1",
+		want: "inset-x-1",
+	},
+	{
+		in:   "inset-x-1 right-1 inset-y-1",
+		want: "inset-x-1 right-1 inset-y-1",
+	},
+	{
+		in:   "right-1 inset-x-1 inset-y-1",
+		want: "inset-x-1 inset-y-1",
+	},
+	{
+		in:   "inset-x-1 hover:left-1 inset-1",
+		want: "hover:left-1 inset-1",
+	},
+	// ring and shadow classes do not create conflict
+	{
+		in:   "ring shadow",
+		want: "ring shadow",
+	},
+	{
+		in:   "ring-2 shadow-md",
+		want: "ring-2 shadow-md",
+	},
+	{
+		in:   "shadow ring",
+		want: "shadow ring",
+	},
+	{
+		in:   "shadow-md ring-2",
+		want: "shadow-md ring-2",
+	},
+	// touch classes do create conflicts correctly
+	{
+		in:   "touch-pan-x touch-pan-right",
+		want: "touch-pan-right",
+	},
+	{
+		in:   "touch-none touch-pan-x",
+		want: "touch-pan-x",
+	},
+	{
+		in:   "touch-pan-x touch-none",
+		want: "touch-none",
+	},
+	{
+		in:   "touch-pan-x touch-pan-y touch-pinch-zoom",
+		want: "touch-pan-x touch-pan-y touch-pinch-zoom",
+	},
+	{
+		in:   "touch-manipulation touch-pan-x touch-pan-y touch-pinch-zoom",
+		want: "touch-pan-x touch-pan-y touch-pinch-zoom",
+	},
+	{
+		in:   "touch-pan-x touch-pan-y touch-pinch-zoom touch-auto",
+		want: "touch-auto",
+	},
+	// line-clamp classes do create conflicts correctly
+	{
+		in:   "overflow-auto inline line-clamp-1",
+		want: "line-clamp-1",
+	},
+	{
+		in:   "line-clamp-1 overflow-auto inline",
+		want: "line-clamp-1 overflow-auto inline",
+	},
+	// merges content utilities correctly
+	{
+		in:   "content-['hello'] content-[attr(data-content)]",
+		want: "content-[attr(data-content)]",
+	},
+	// merges tailwind classes with important modifier correctly
+	{
+		in:   "!font-medium !font-bold",
+		want: "!font-bold",
+	},
+	{
+		in:   "!font-medium !font-bold font-thin",
+		want: "!font-bold font-thin",
+	},
+	{
+		in:   "!right-2 !-inset-x-px",
+		want: "!-inset-x-px",
+	},
+	{
+		in:   "focus:!inline focus:!block",
+		want: "focus:!block",
+	},
+	// conflicts across prefix modifiers
+	{
+		in:   "hover:block hover:inline",
+		want: "hover:inline",
+	},
+	{
+		in:   "hover:block hover:focus:inline",
+		want: "hover:block hover:focus:inline",
+	},
+	{
+		in:   "hover:block hover:focus:inline focus:hover:inline",
+		want: "hover:block focus:hover:inline",
+	},
+	{
+		in:   "focus-within:inline focus-within:block",
+		want: "focus-within:block",
+	},
+	// conflicts across postfix modifiers
+	{
+		in:   "text-lg/7 text-lg/8",
+		want: "text-lg/8",
+	},
+	{
+		in:   "text-lg/none leading-9",
+		want: "text-lg/none leading-9",
+	},
+	{
+		in:   "leading-9 text-lg/none",
+		want: "text-lg/none",
+	},
+	{
+		in:   "w-full w-1/2",
+		want: "w-1/2",
+	},
+	// handles negative value conflicts correctly
+	{
+		in:   "-m-2 -m-5",
+		want: "-m-5",
+	},
+	{
+		in:   "top-12 -top-12 ",
+		want: "-top-12",
+	},
+	// handles conflicts between positive and negative values correctly
+	{
+		in:   "-m-2 m-auto",
+		want: "m-auto",
+	},
+	// handles conflicts across groups with negative values correctly
+	{
+		in:   "-right-1 inset-x-1",
+		want: "inset-x-1",
+	},
+	{
+		in:   "hover:focus:-right-1 focus:hover:inset-x-1",
+		want: "focus:hover:inset-x-1",
+	},
+
+	// merges non-conflicting classes correctly
+	{
+		in:   "border-t border-white/10",
+		want: "border-t border-white/10",
+	},
+	{
+		in:   "border-t border-white",
+		want: "border-t border-white",
+	},
+	{
+		in:   "text-2xl text-black",
+		want: "text-2xl text-black",
+	},
+	// handles pseudo variants conflicts properly
+	{
+		in:   "empty:p-2 empty:p-3",
+		want: "empty:p-3",
+	},
+	{
+		in:   "hover:empty:p-2 hover:empty:p-3",
+		want: "hover:empty:p-3",
+	},
+	{
+		in:   "read-only:p-2 read-only:p-3",
+		want: "read-only:p-3",
+	},
+	// handles pseudo variant group conflicts properly
+	{
+		in:   "group-empty:p-2 group-empty:p-3",
+		want: "group-empty:p-3",
+	},
+	{
+		in:   "peer-empty:p-2 peer-empty:p-3",
+		want: "peer-empty:p-3",
+	},
+	{
+		in:   "group-empty:p-2 peer-empty:p-3",
+		want: "group-empty:p-2 peer-empty:p-3",
+	},
+	{
+		in:   "hover:group-empty:p-2 hover:group-empty:p-3",
+		want: "hover:group-empty:p-3",
+	},
+	{
+		in:   "group-read-only:p-2 group-read-only:p-3",
+		want: "group-read-only:p-3",
+	},
+	// merges standalone classes from same group correctly
+	{
+		in:   "inline block",
+		want: "block",
+	},
+	{
+		in:   "hover:block hover:inline",
+		want: "hover:inline",
+	},
+	{
+		in:   "hover:block hover:block",
+		want: "hover:block",
+	},
+	{
+		in:   "inline hover:inline focus:inline hover:block hover:focus:block",
+		want: "inline focus:inline hover:block hover:focus:block",
+	},
+	{
+		in:   "underline line-through",
+		want: "line-through",
+	},
+	{
+		in:   "line-through no-underline",
+		want: "no-underline",
+	},
+	// supports Tailwind CSS v3.3 features
+	{
+		in:   "hyphens-auto hyphens-manual",
+		want: "hyphens-manual",
+	},
+	{
+		in:   "caption-top caption-bottom",
+		want: "caption-bottom",
+	},
+	{
+		in:   "line-clamp-2 line-clamp-none line-clamp-[10]",
+		want: "line-clamp-[10]",
+	},
+	{
+		in:   "delay-150 delay-0 duration-150 duration-0",
+		want: "delay-0 duration-0",
+	},
+	{
+		in:   "justify-normal justify-center justify-stretch",
+		want: "justify-stretch",
+	},
+	{
+		in:   "content-normal content-center content-stretch",
+		want: "content-stretch",
+	},
+	{
+		in:   "whitespace-nowrap whitespace-break-spaces",
+		want: "whitespace-break-spaces",
+	},
+	// supports Tailwind CSS v3.4 features
+	{
+		in:   "h-svh h-dvh w-svw w-dvw",
+		want: "h-dvh w-dvw",
+	},
+	{
+		in:   "text-wrap text-pretty",
+		want: "text-pretty",
+	},
+	{
+		in:   "w-5 h-3 size-10 w-12",
+		want: "size-10 w-12",
+	},
+	{
+		in:   "grid-cols-2 grid-cols-subgrid grid-rows-5 grid-rows-subgrid",
+		want: "grid-cols-subgrid grid-rows-subgrid",
+	},
+	{
+		in:   "min-w-0 min-w-px max-w-0 max-w-px",
+		want: "min-w-px max-w-px",
+	},
+	{
+		in:   "forced-color-adjust-none forced-color-adjust-auto",
+		want: "forced-color-adjust-auto",
+	},
+	{
+		in:   "appearance-none appearance-auto",
+		want: "appearance-auto",
+	},
+	{
+		in:   "float-start float-end clear-start clear-end",
+		want: "float-end clear-end",
+	},
+	{
+		in:   "*:p-10 *:p-20 hover:*:p-10 hover:*:p-20",
+		want: "*:p-20 hover:*:p-20",
+	},
+	{
+		in:   "mix-blend-normal mix-blend-multiply",
+		want: "mix-blend-multiply",
+	},
+	{
+		in:   "h-10 h-min",
+		want: "h-min",
+	},
+	{
+		in:   "stroke-black stroke-1",
+		want: "stroke-black stroke-1",
+	},
+	{
+		in:   "stroke-2 stroke-[3]",
+		want: "stroke-[3]",
+	},
+	{
+		in:   "outline-black outline-1",
+		want: "outline-black outline-1",
+	},
+	{
+		in:   "grayscale-0 grayscale-[50%]",
+		want: "grayscale-[50%]",
+	},
+	{
+		in:   "grow grow-[2]",
+		want: "grow-[2]",
+	},
+	// keeps unknown classes
+	{
+		in:   "grow grow-[2] unrecognized-class",
+		want: "grow-[2] unrecognized-class",
+	},
+	{
+		in:   "unrecognized-class grow grow-[2]",
+		want: "unrecognized-class grow-[2]",
+	},
+	// handles :is() pseudo-class
+	{
+		in:   "dark:bg-green-500/20 dark:bg-blue-500/20",
+		want: "dark:bg-blue-500/20",
+	},
+	{
+		in:   "dark:bg-blue-500/20 dark:bg-green-500/20",
+		want: "dark:bg-green-500/20",
+	},
+	// single class
+	{
+		in:   "p-1 ",
+		want: "p-1 ",
+	},
+	// simple conflict
+	{
+		in:   "p-1 p-2",
+		want: "p-2",
+	},
+	{
+		in:   "p-2 p-1",
+		want: "p-1",
+	},
+	// conditional
+	{
+		in:   "read-only:p-2 p-1",
+		want: "read-only:p-2 p-1",
+	},
+	{
+		in:   "space-x-16 space-x-2",
+		want: "space-x-2",
+	},
+	// handles important
+	{
+		in:   "p-3Important p-2",
+		want: "p-3Important p-2",
+	},
+	{
+		in:   "class2 class3",
+		want: "class2 class3",
+	},
+}
+
 func TestMerge(t *testing.T) {
+	runMergeTests(t, "./internal/cascadia/test_resources/test_output.css", DirectionUnknown)
+}
+
+// mergeTestDifferences are the results of the test corpus that deliberately differ from tailwind-merge, by input.
+// They are kept out of mergeTests, so that the corpus can be generated again as it is.
+var mergeTestDifferences = map[string]string{
+	// font-thin cannot win font-weight over the !important declaration of !font-bold (see TestMergeImportant)
+	"!font-medium !font-bold font-thin": "!font-bold",
+	// p-2 cannot win any padding over the !important declaration of p-3Important (see TestMergeImportant)
+	"p-3Important p-2": "p-3Important",
+}
+
+// runMergeTests runs the test corpus against a stylesheet, with the direction of the documents set to dir.
+func runMergeTests(t *testing.T, stylesheet string, dir Direction) {
+	t.Helper()
+	tt := mergeTests
+	by, err := os.ReadFile(stylesheet)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	r := NewMerger(nil, true)
+	r.SetDirection(dir)
+	err = r.AddRules(bytes.NewBuffer(by), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	failed := 0
+	passed := 0
+	for _, tc := range tt {
+		if want, ok := mergeTestDifferences[tc.in]; ok {
+			tc.want = want
+		}
+		t.Run(tc.in, func(t *testing.T) {
+			got := r.Merge(tc.in)
+			if got != tc.want {
+				failed++
+				t.Errorf("TestMerge fail: in %v, want %v, got %v", tc.in, tc.want, got)
+			} else {
+				passed++
+			}
+		})
+	}
+	if len(tt)-failed-passed > 0 {
+		t.Errorf("TestMerge failed %d, passed %d", failed, passed)
+	}
+}
+
+func TestMergeTailwindV4(t *testing.T) {
+	// Tailwind v4 uses logical properties (e.g., inset-x-1 is inset-inline, my-[2px] is margin-block),
+	// which are the physical properties of the corpus in a left-to-right document.
+	runMergeTests(t, "./internal/cascadia/test_resources/test_output_v4.css", DirectionLTR)
+}
+
+func TestMergeLayers(t *testing.T) {
+	rules := `
+	@layer base, components, utilities;
+
+	@layer utilities {
+		.p-1 {
+			padding: 0.25rem;
+		}
+		.p-2 {
+			padding: 0.5rem;
+		}
+	}
+
+	@layer components {
+		.btn {
+			padding: 1rem;
+			color: red;
+		}
+	}
+
+	@layer base {
+		.reset {
+			padding: 0;
+		}
+	}
+
+	.unlayered {
+		padding: 2rem;
+	}
+	`
+
 	tt := []struct {
 		in   string
 		want string
 	}{
-		// color variants
-		{
-			in:   "border-white border-white/10",
-			want: "border-white/10",
-		},
-		{
-			in:   "border-white/10 border-white",
-			want: "border-white",
-		},
-		// handles arbitrary property conflicts correctly
-		{
-			in:   "[paint-order:markers] [paint-order:normal]",
-			want: "[paint-order:normal]",
-		},
-		// handles arbitrary property conflicts with modifiers correctly
-		{
-			in:   "[paint-order:markers] hover:[paint-order:normal]",
-			want: "[paint-order:markers] hover:[paint-order:normal]",
-		},
-		{
-			in:   "hover:[paint-order:markers] hover:[paint-order:normal]",
-			want: "hover:[paint-order:normal]",
-		},
-		{
-			in:   "hover:focus:[paint-order:markers] focus:hover:[paint-order:normal]",
-			want: "focus:hover:[paint-order:normal]",
-		},
-		// handles simple conflicts with arbitrary values correctly
-		{
-			in:   "m-[2px] m-[10px]",
-			want: "m-[10px]",
-		},
-		{
-			in:   "z-20 z-[99]",
-			want: "z-[99]",
-		},
-		{
-			in:   "my-[2px] m-[10rem]",
-			want: "m-[10rem]",
-		},
-		{
-			in:   "cursor-pointer cursor-[grab]",
-			want: "cursor-[grab]",
-		},
-		{
-			in:   "m-[calc(100%-var(--arbitrary))] m-[2px]",
-			want: "m-[2px]",
-		},
-		{
-			in:   "m-[2px] m-[length:var(--mystery-var)]",
-			want: "m-[length:var(--mystery-var)]",
-		},
-		{
-			in:   "opacity-10 opacity-[0.025]",
-			want: "opacity-[0.025]",
-		},
-		{
-			in:   "scale-75 scale-[1.7]",
-			want: "scale-[1.7]",
-		},
-		{
-			in:   "brightness-90 brightness-[1.75]",
-			want: "brightness-[1.75]",
-		},
-		{
-			in:   "min-h-[0.5px] min-h-[0]",
-			want: "min-h-[0]",
-		},
-		{
-			in:   "text-[0.5px] text-[color:0]",
-			want: "text-[0.5px] text-[color:0]",
-		},
-		{
-			in:   "text-[0.5px] text-[--my-0]",
-			want: "text-[0.5px] text-[--my-0]",
-		},
-		// handles arbitrary length conflicts with labels and modifiers correctly
-		{
-			in:   "hover:m-[2px] hover:m-[length:var(--c)]",
-			want: "hover:m-[length:var(--c)]",
-		},
-		{
-			in:   "hover:focus:m-[2px] focus:hover:m-[length:var(--c)]",
-			want: "focus:hover:m-[length:var(--c)]",
-		},
-		// handles complex arbitrary value conflicts correctly
-		{
-			in:   "grid-rows-[1fr,auto] grid-rows-2",
-			want: "grid-rows-2",
-		},
-		{
-			in:   "grid-rows-[repeat(20,minmax(0,1fr))] grid-rows-3",
-			want: "grid-rows-3",
-		},
-		// handles ambiguous arbitrary values correctly
-		{
-			in:   "mt-2 mt-[calc(theme(fontSize.4xl)/1.125)]",
-			want: "mt-[calc(theme(fontSize.4xl)/1.125)]",
-		},
-		{
-			in:   "p-2 p-[calc(theme(fontSize.4xl)/1.125)_10px]",
-			want: "p-[calc(theme(fontSize.4xl)/1.125)_10px]",
-		},
-		{
-			in:   "bg-cover bg-[percentage:30%] bg-[length:200px_100px]",
-			want: "bg-[length:200px_100px]",
-		},
-		// basic arbitrary variants
-		{
-			in:   "[&>*]:underline [&>*]:line-through",
-			want: "[&>*]:line-through",
-		},
-		{
-			in:   "[&>*]:underline [&>*]:line-through [&_div]:line-through",
-			want: "[&>*]:line-through [&_div]:line-through",
-		},
-		{
-			in:   "supports-[display:grid]:flex supports-[display:grid]:grid",
-			want: "supports-[display:grid]:grid",
-		},
-		// arbitrary variants with modifiers
-		{
-			in:   "dark:lg:hover:[&>*]:underline dark:lg:hover:[&>*]:line-through",
-			want: "dark:lg:hover:[&>*]:line-through",
-		},
-		{
-			in:   "dark:lg:hover:[&>*]:underline dark:hover:lg:[&>*]:line-through",
-			want: "dark:hover:lg:[&>*]:line-through",
-		},
-		{
-			in:   "hover:[&>*]:underline [&>*]:hover:line-through",
-			want: "hover:[&>*]:underline [&>*]:hover:line-through",
-		},
-		// arbitrary variants with attribute selectors
-		{
-			in:   "[&[data-open]]:underline [&[data-open]]:line-through",
-			want: "[&[data-open]]:line-through",
-		},
-		// multiple arbitrary variants
-		{
-			in:   "[&>*]:[&_div]:underline [&>*]:[&_div]:line-through",
-			want: "[&>*]:[&_div]:line-through",
-		},
-		{
-			in:   "[&>*]:[&_div]:underline [&_div]:[&>*]:line-through",
-			want: "[&>*]:[&_div]:underline [&_div]:[&>*]:line-through",
-		},
-		// arbitrary variants with arbitrary properties
-		{
-			in:   "[&>*]:[color:red] [&>*]:[color:blue]",
-			want: "[&>*]:[color:blue]",
-		},
-		// merges classes from same group correctly
-		{
-			in:   "overflow-x-auto overflow-x-hidden",
-			want: "overflow-x-hidden",
-		},
-		{
-			in:   "basis-full basis-auto",
-			want: "basis-auto",
-		},
-		{
-			in:   "w-full w-fit",
-			want: "w-fit",
-		},
-		{
-			in:   "overflow-x-auto overflow-x-hidden overflow-x-scroll",
-			want: "overflow-x-scroll",
-		},
-		{
-			in:   "overflow-x-auto hover:overflow-x-hidden overflow-x-scroll",
-			want: "hover:overflow-x-hidden overflow-x-scroll",
-		},
-		{
-			in:   "col-span-1 col-span-full",
-			want: "col-span-full",
-		},
-		// merges classes from Font Variant Numeric section correctly
-		{
-			in:   "lining-nums tabular-nums diagonal-fractions",
-			want: "lining-nums tabular-nums diagonal-fractions",
-		},
-		{
-			in:   "normal-nums tabular-nums diagonal-fractions",
-			want: "tabular-nums diagonal-fractions",
-		},
-		{
-			in:   "tabular-nums diagonal-fractions normal-nums",
-			want: "normal-nums",
-		},
-		{
-			in:   "tabular-nums proportional-nums",
-			want: "proportional-nums",
-		},
-		// handles color conflicts properly
-		{
-			in:   "hover:bg-destructive/90 hover:bg-accent",
-			want: "hover:bg-accent",
-		},
-		{
-			in:   "stroke-[hsl(350_80%_0%)] stroke-[10px]",
-			want: "stroke-[hsl(350_80%_0%)] stroke-[10px]",
-		},
-		// handles conflicts across class groups correctly
-		{
-			in:   "inset-1 inset-x-1",
-			want: "inset-1 inset-x-1",
-		},
-		{
-			in:   "inset-x-1 inset-1",
-			want: "inset-1",
-		},
-		{
-			in:   "inset-x-1 left-1 inset-1",
-			want: "inset-1",
-		},
-		{
-			in:   "inset-x-1 inset-1 left-1",
-			want: "inset-1 left-1",
-		},
-		{
-			in:   "inset-x-1 right-1 inset-1",
-			want: "inset-1",
-		},
-		{
-			in:   "inset-x-1 right-1 inset-x-1",
-			want: "inset-x-1",
-		},
-		{
-			in:   "inset-x-1 right-1 inset-y-1",
-			want: "inset-x-1 right-1 inset-y-1",
-		},
-		{
-			in:   "right-1 inset-x-1 inset-y-1",
-			want: "inset-x-1 inset-y-1",
-		},
-		{
-			in:   "inset-x-1 hover:left-1 inset-1",
-			want: "hover:left-1 inset-1",
-		},
-		// ring and shadow classes do not create conflict
-		{
-			in:   "ring shadow",
-			want: "ring shadow",
-		},
-		{
-			in:   "ring-2 shadow-md",
-			want: "ring-2 shadow-md",
-		},
-		{
-			in:   "shadow ring",
-			want: "shadow ring",
-		},
-		{
-			in:   "shadow-md ring-2",
-			want: "shadow-md ring-2",
-		},
-		// touch classes do create conflicts correctly
-		{
-			in:   "touch-pan-x touch-pan-right",
-			want: "touch-pan-right",
-		},
-		{
-			in:   "touch-none touch-pan-x",
-			want: "touch-pan-x",
-		},
-		{
-			in:   "touch-pan-x touch-none",
-			want: "touch-none",
-		},
-		{
-			in:   "touch-pan-x touch-pan-y touch-pinch-zoom",
-			want: "touch-pan-x touch-pan-y touch-pinch-zoom",
-		},
-		{
-			in:   "touch-manipulation touch-pan-x touch-pan-y touch-pinch-zoom",
-			want: "touch-pan-x touch-pan-y touch-pinch-zoom",
-		},
-		{
-			in:   "touch-pan-x touch-pan-y touch-pinch-zoom touch-auto",
-			want: "touch-auto",
-		},
-		// line-clamp classes do create conflicts correctly
-		{
-			in:   "overflow-auto inline line-clamp-1",
-			want: "line-clamp-1",
-		},
-		{
-			in:   "line-clamp-1 overflow-auto inline",
-			want: "line-clamp-1 overflow-auto inline",
-		},
-		// merges content utilities correctly
-		{
-			in:   "content-['hello'] content-[attr(data-content)]",
-			want: "content-[attr(data-content)]",
-		},
-		// merges tailwind classes with important modifier correctly
-		{
-			in:   "!font-medium !font-bold",
-			want: "!font-bold",
-		},
-		{
-			in:   "!font-medium !font-bold font-thin",
-			want: "!font-bold font-thin",
-		},
-		{
-			in:   "!right-2 !-inset-x-px",
-			want: "!-inset-x-px",
-		},
-		{
-			in:   "focus:!inline focus:!block",
-			want: "focus:!block",
-		},
-		// conflicts across prefix modifiers
-		{
-			in:   "hover:block hover:inline",
-			want: "hover:inline",
-		},
-		{
-			in:   "hover:block hover:focus:inline",
-			want: "hover:block hover:focus:inline",
-		},
-		{
-			in:   "hover:block hover:focus:inline focus:hover:inline",
-			want: "hover:block focus:hover:inline",
-		},
-		{
-			in:   "focus-within:inline focus-within:block",
-			want: "focus-within:block",
-		},
-		// conflicts across postfix modifiers
-		{
-			in:   "text-lg/7 text-lg/8",
-			want: "text-lg/8",
-		},
-		{
-			in:   "text-lg/none leading-9",
-			want: "text-lg/none leading-9",
-		},
-		{
-			in:   "leading-9 text-lg/none",
-			want: "text-lg/none",
-		},
-		{
-			in:   "w-full w-1/2",
-			want: "w-1/2",
-		},
-		// handles negative value conflicts correctly
-		{
-			in:   "-m-2 -m-5",
-			want: "-m-5",
-		},
-		{
-			in:   "top-12 -top-12 ",
-			want: "-top-12",
-		},
-		// handles conflicts between positive and negative values correctly
-		{
-			in:   "-m-2 m-auto",
-			want: "m-auto",
-		},
-		// handles conflicts across groups with negative values correctly
-		{
-			in:   "-right-1 inset-x-1",
-			want: "inset-x-1",
-		},
-		{
-			in:   "hover:focus:-right-1 focus:hover:inset-x-1",
-			want: "focus:hover:inset-x-1",
-		},
+		// same layer: the last class wins
+		{in: "p-1 p-2", want: "p-2"},
+		// higher layer wins even if it is earlier in the class string
+		{in: "p-1 btn", want: "p-1 btn"},
+		{in: "btn p-1", want: "btn p-1"},
+		{in: "p-1 reset", want: "p-1"},
+		{in: "reset p-1", want: "p-1"},
+		// unlayered rules beat all layers
+		{in: "unlayered p-1", want: "unlayered"},
+		{in: "p-1 unlayered", want: "unlayered"},
+	}
 
-		// merges non-conflicting classes correctly
-		{
-			in:   "border-t border-white/10",
-			want: "border-t border-white/10",
-		},
-		{
-			in:   "border-t border-white",
-			want: "border-t border-white",
-		},
-		{
-			in:   "text-2xl text-black",
-			want: "text-2xl text-black",
-		},
-		// handles pseudo variants conflicts properly
-		{
-			in:   "empty:p-2 empty:p-3",
-			want: "empty:p-3",
-		},
-		{
-			in:   "hover:empty:p-2 hover:empty:p-3",
-			want: "hover:empty:p-3",
-		},
-		{
-			in:   "read-only:p-2 read-only:p-3",
-			want: "read-only:p-3",
-		},
-		// handles pseudo variant group conflicts properly
-		{
-			in:   "group-empty:p-2 group-empty:p-3",
-			want: "group-empty:p-3",
-		},
-		{
-			in:   "peer-empty:p-2 peer-empty:p-3",
-			want: "peer-empty:p-3",
-		},
-		{
-			in:   "group-empty:p-2 peer-empty:p-3",
-			want: "group-empty:p-2 peer-empty:p-3",
-		},
-		{
-			in:   "hover:group-empty:p-2 hover:group-empty:p-3",
-			want: "hover:group-empty:p-3",
-		},
-		{
-			in:   "group-read-only:p-2 group-read-only:p-3",
-			want: "group-read-only:p-3",
-		},
-		// merges standalone classes from same group correctly
-		{
-			in:   "inline block",
-			want: "block",
-		},
-		{
-			in:   "hover:block hover:inline",
-			want: "hover:inline",
-		},
-		{
-			in:   "hover:block hover:block",
-			want: "hover:block",
-		},
-		{
-			in:   "inline hover:inline focus:inline hover:block hover:focus:block",
-			want: "inline focus:inline hover:block hover:focus:block",
-		},
-		{
-			in:   "underline line-through",
-			want: "line-through",
-		},
-		{
-			in:   "line-through no-underline",
-			want: "no-underline",
-		},
-		// supports Tailwind CSS v3.3 features
-		{
-			in:   "hyphens-auto hyphens-manual",
-			want: "hyphens-manual",
-		},
-		{
-			in:   "caption-top caption-bottom",
-			want: "caption-bottom",
-		},
-		{
-			in:   "line-clamp-2 line-clamp-none line-clamp-[10]",
-			want: "line-clamp-[10]",
-		},
-		{
-			in:   "delay-150 delay-0 duration-150 duration-0",
-			want: "delay-0 duration-0",
-		},
-		{
-			in:   "justify-normal justify-center justify-stretch",
-			want: "justify-stretch",
-		},
-		{
-			in:   "content-normal content-center content-stretch",
-			want: "content-stretch",
-		},
-		{
-			in:   "whitespace-nowrap whitespace-break-spaces",
-			want: "whitespace-break-spaces",
-		},
-		// supports Tailwind CSS v3.4 features
-		{
-			in:   "h-svh h-dvh w-svw w-dvw",
-			want: "h-dvh w-dvw",
-		},
-		{
-			in:   "text-wrap text-pretty",
-			want: "text-pretty",
-		},
-		{
-			in:   "w-5 h-3 size-10 w-12",
-			want: "size-10 w-12",
-		},
-		{
-			in:   "grid-cols-2 grid-cols-subgrid grid-rows-5 grid-rows-subgrid",
-			want: "grid-cols-subgrid grid-rows-subgrid",
-		},
-		{
-			in:   "min-w-0 min-w-px max-w-0 max-w-px",
-			want: "min-w-px max-w-px",
-		},
-		{
-			in:   "forced-color-adjust-none forced-color-adjust-auto",
-			want: "forced-color-adjust-auto",
-		},
-		{
-			in:   "appearance-none appearance-auto",
-			want: "appearance-auto",
-		},
-		{
-			in:   "float-start float-end clear-start clear-end",
-			want: "float-end clear-end",
-		},
-		{
-			in:   "*:p-10 *:p-20 hover:*:p-10 hover:*:p-20",
-			want: "*:p-20 hover:*:p-20",
-		},
-		{
-			in:   "mix-blend-normal mix-blend-multiply",
-			want: "mix-blend-multiply",
-		},
-		{
-			in:   "h-10 h-min",
-			want: "h-min",
-		},
-		{
-			in:   "stroke-black stroke-1",
-			want: "stroke-black stroke-1",
-		},
-		{
-			in:   "stroke-2 stroke-[3]",
-			want: "stroke-[3]",
-		},
-		{
-			in:   "outline-black outline-1",
-			want: "outline-black outline-1",
-		},
-		{
-			in:   "grayscale-0 grayscale-[50%]",
-			want: "grayscale-[50%]",
-		},
-		{
-			in:   "grow grow-[2]",
-			want: "grow-[2]",
-		},
-		// keeps unknown classes
-		{
-			in:   "grow grow-[2] unrecognized-class",
-			want: "grow-[2] unrecognized-class",
-		},
-		{
-			in:   "unrecognized-class grow grow-[2]",
-			want: "unrecognized-class grow-[2]",
-		},
-		// handles :is() pseudo-class
-		{
-			in:   "dark:bg-green-500/20 dark:bg-blue-500/20",
-			want: "dark:bg-blue-500/20",
-		},
-		{
-			in:   "dark:bg-blue-500/20 dark:bg-green-500/20",
-			want: "dark:bg-green-500/20",
-		},
-		// single class
-		{
-			in:   "p-1 ",
-			want: "p-1 ",
-		},
-		// simple conflict
-		{
-			in:   "p-1 p-2",
-			want: "p-2",
-		},
-		{
-			in:   "p-2 p-1",
-			want: "p-1",
-		},
-		// conditional
-		{
-			in:   "read-only:p-2 p-1",
-			want: "read-only:p-2 p-1",
-		},
-		{
-			in:   "space-x-16 space-x-2",
-			want: "space-x-2",
-		},
-		// handles important
-		{
-			in:   "p-3Important p-2",
-			want: "p-3Important p-2",
-		},
-		{
-			in:   "class2 class3",
-			want: "class2 class3",
-		},
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			got := r.Merge(tc.in)
+			if got != tc.want {
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeMultipleRulesPerClass(t *testing.T) {
+	rules := `
+	.btn {
+		padding: 1rem;
+		color: black;
+	}
+	.btn:hover {
+		color: red;
+	}
+	.group:hover .btn {
+		color: green;
+	}
+	@media (min-width: 640px) {
+		.btn {
+			padding: 2rem;
+		}
+	}
+	.p-2 {
+		padding: 0.5rem;
+	}
+	.text-blue {
+		color: blue;
+	}
+	.hover\:text-blue:hover {
+		color: blue;
+	}
+	@media (min-width: 640px) {
+		.sm\:p-4 {
+			padding: 1rem;
+		}
+	}
+	`
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		{in: "btn p-2", want: "btn p-2"},
+		{in: "p-2 btn", want: "btn"},
+		// btn still sets the color on hover and the padding on larger screens
+		{in: "btn text-blue p-2", want: "btn text-blue p-2"},
+		{in: "hover:text-blue btn", want: "btn"},
+		{in: "btn hover:text-blue", want: "btn hover:text-blue"},
+		{in: "sm:p-4 btn", want: "btn"},
+		{in: "btn sm:p-4", want: "btn sm:p-4"},
+	}
+
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	if got := len(r.Rules()["btn"]); got != 4 {
+		t.Errorf("got %d rules for btn, want 4", got)
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			got := r.Merge(tc.in)
+			if got != tc.want {
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeNestedConditions(t *testing.T) {
+	rules := `
+	.p-1 {
+		padding: 0.25rem;
+	}
+	@supports (display: grid) {
+		@media (min-width: 640px) {
+			.supports-sm-p-2 {
+				padding: 0.5rem;
+			}
+			.supports-sm-hover-p-2:hover {
+				padding: 0.5rem;
+			}
+		}
+		.supports-p-2 {
+			padding: 0.5rem;
+		}
+		.supports-p-3 {
+			padding: 0.75rem;
+		}
+	}
+	@media (min-width: 640px) {
+		.sm\:p-2 {
+			padding: 0.5rem;
+		}
+		.sm\:hover\:p-2:hover {
+			padding: 0.5rem;
+		}
+		.group:hover .sm\:group-hover\:p-2 {
+			padding: 0.5rem;
+		}
+	}
+	.hover\:p-2:hover {
+		padding: 0.5rem;
+	}
+	.group:hover .group-hover\:p-2 {
+		padding: 0.5rem;
+	}
+	`
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		// the outer condition is not lost after a nested block
+		{in: "supports-p-2 supports-p-3", want: "supports-p-3"},
+		{in: "supports-p-2 p-1", want: "supports-p-2 p-1"},
+		// a partial chain is a different condition
+		{in: "supports-sm-p-2 sm:p-2", want: "supports-sm-p-2 sm:p-2"},
+		{in: "supports-sm-p-2 supports-p-2", want: "supports-sm-p-2 supports-p-2"},
+		// pseudo-classes and at-rules are combined
+		{in: "sm:hover:p-2 hover:p-2", want: "sm:hover:p-2 hover:p-2"},
+		{in: "supports-sm-hover-p-2 sm:hover:p-2", want: "supports-sm-hover-p-2 sm:hover:p-2"},
+		// combined selectors keep the at-rule condition
+		{in: "sm:group-hover:p-2 group-hover:p-2", want: "sm:group-hover:p-2 group-hover:p-2"},
+	}
+
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			got := r.Merge(tc.in)
+			if got != tc.want {
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeRegisteredProperties(t *testing.T) {
+	by, err := os.ReadFile("./internal/cascadia/test_resources/test_output_v4.css")
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	r := NewMerger(nil, false)
+	err = r.AddRules(bytes.NewBuffer(by), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	tt := []struct {
+		name         string
+		initialValue string
+		ok           bool
+	}{
+		{name: "--tw-shadow", initialValue: "0 0 #0000", ok: true},
+		{name: "--tw-ring-offset-width", initialValue: "0px", ok: true},
+		{name: "--tw-pan-x", ok: true},
+		{name: "--spacing"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			prop, ok := r.RegisteredProperties()[tc.name]
+			if ok != tc.ok {
+				t.Fatalf("RegisteredProperties()[%q] found %v, want %v", tc.name, ok, tc.ok)
+			}
+			if prop.InitialValue != tc.initialValue {
+				t.Errorf("RegisteredProperties()[%q] initial value %q, want %q", tc.name, prop.InitialValue, tc.initialValue)
+			}
+		})
+	}
+}
+
+func TestMergeNativeNesting(t *testing.T) {
+	rules := `
+	.card {
+		padding: 1rem;
+		&:hover {
+			padding: 2rem;
+		}
+		@media (min-width: 640px) {
+			padding: 3rem;
+		}
+	}
+	.p-4 {
+		padding: 1rem;
+	}
+	.hover\:p-8 {
+		&:hover {
+			padding: 2rem;
+		}
+	}
+	.sm\:p-12 {
+		@media (min-width: 640px) {
+			padding: 3rem;
+		}
+	}
+	.hover\:p-4:hover {
+		padding: 1rem;
+	}
+	`
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		// the nested rules of card still apply
+		{in: "card p-4", want: "card p-4"},
+		{in: "card p-4 hover:p-8", want: "card p-4 hover:p-8"},
+		// every rule of card is overridden
+		{in: "card p-4 hover:p-8 sm:p-12", want: "p-4 hover:p-8 sm:p-12"},
+		// a nested rule is the same as a flat rule
+		{in: "hover:p-8 hover:p-4", want: "hover:p-4"},
+		{in: "hover:p-4 hover:p-8", want: "hover:p-8"},
 	}
-	by, err := os.ReadFile("./internal/cascadia/test_resources/test_output.css")
+
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
 	if err != nil {
-		t.Fatalf("ReadFile returned error: %v", err)
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			got := r.Merge(tc.in)
+			if got != tc.want {
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeSpecificity(t *testing.T) {
+	rules := `
+	.p-1 {
+		padding: 0.25rem;
+	}
+	.p-2 {
+		padding: 0.5rem;
+	}
+	.p-strong.p-strong {
+		padding: 1rem;
+	}
+	.hover\:p-1:hover {
+		padding: 0.25rem;
+	}
+	.hover\:p-strong.hover\:p-strong:hover {
+		padding: 1rem;
+	}
+	:is(#x) .b {
+		padding: 2rem;
+	}
+	.c {
+		padding: 3rem;
+	}
+	.imp {
+		padding: 2rem !important;
+	}
+	.imp-strong.imp-strong {
+		padding: 1rem !important;
+	}
+	@layer base {
+		.base-strong.base-strong {
+			padding: 1rem;
+		}
+	}
+	`
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		// a later class with a lower specificity cannot win
+		{in: "p-strong p-1", want: "p-strong"},
+		{in: "p-strong p-1 p-2", want: "p-strong"},
+		{in: "p-1 p-strong", want: "p-strong"},
+		{in: "hover:p-strong hover:p-1", want: "hover:p-strong"},
+		// the conditions are still compared separately
+		{in: "p-strong hover:p-1", want: "p-strong hover:p-1"},
+		{in: "hover:p-strong p-1", want: "hover:p-strong p-1"},
+		// a rule that depends on the context only wins in that context
+		{in: "b c", want: "b c"},
+		{in: "c b", want: "c b"},
+		// specificity is compared between important properties as well
+		{in: "imp-strong imp", want: "imp-strong"},
+		// layers come before specificity
+		{in: "base-strong p-1", want: "p-1"},
 	}
+
 	r := NewMerger(nil, true)
-	err = r.AddRules(bytes.NewBuffer(by), false)
+	err := r.AddRules(strings.NewReader(rules), false)
 	if err != nil {
 		t.Fatalf("AddRules returned error: %v", err)
 	}
-	failed := 0
-	passed := 0
 	for _, tc := range tt {
 		t.Run(tc.in, func(t *testing.T) {
 			got := r.Merge(tc.in)
 			if got != tc.want {
-				failed++
-				t.Errorf("TestMerge fail: in %v, want %v, got %v", tc.in, tc.want, got)
-			} else {
-				passed++
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
 			}
 		})
 	}
-	if len(tt)-failed-passed > 0 {
-		t.Errorf("TestMerge failed %d, passed %d", failed, passed)
+}
+
+func TestMergeContextClasses(t *testing.T) {
+	rules := `
+	.p-4 {
+		padding: 1rem;
+	}
+	.group:hover .group-hover\:p-2 {
+		padding: 0.5rem;
+	}
+	.group:hover .group-hover\:p-3 {
+		padding: 0.75rem;
+	}
+	.peer:checked ~ .peer-checked\:p-2 {
+		padding: 0.5rem;
+	}
+	.peer {
+		position: relative;
+	}
+	.static {
+		position: static;
+	}
+	.space-x-2 > :not([hidden]) ~ :not([hidden]) {
+		margin-left: 0.5rem;
+	}
+	.space-x-4 > :not([hidden]) ~ :not([hidden]) {
+		margin-left: 1rem;
+	}
+	.ml-2 {
+		margin-left: 0.5rem;
+	}
+	`
+
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	// the rules are indexed under their subject, not under the classes they use as context
+	if got, ok := r.Rules()["group"]; ok {
+		t.Errorf("Rules has %d rules for group, want none", len(got))
+	}
+	if got := r.Rules()["peer"]; len(got) != 1 || got[0].Selector.String() != ".peer" {
+		t.Errorf("Rules has %v for peer, want only .peer", got)
+	}
+	if got := r.Rules()["space-x-2"]; len(got) != 1 {
+		t.Errorf("Rules has %d rules for space-x-2, want 1", len(got))
+	}
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		{in: "group p-4", want: "group p-4"},
+		{in: "p-4 group", want: "p-4 group"},
+		{in: "group p-4 group-hover:p-2", want: "group p-4 group-hover:p-2"},
+		{in: "group-hover:p-2 group-hover:p-3", want: "group-hover:p-3"},
+		{in: "peer p-4 peer-checked:p-2", want: "peer p-4 peer-checked:p-2"},
+		{in: "peer static", want: "static"},
+		// a rule for the children of an element belongs to the class of the element
+		{in: "space-x-2 space-x-4", want: "space-x-4"},
+		{in: "space-x-2 ml-2", want: "space-x-2 ml-2"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			if got := r.Merge(tc.in); got != tc.want {
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeSelectorLists(t *testing.T) {
+	// component classes written like Bootstrap's, with rules shared by several selectors
+	rules := `
+	.btn-primary, .btn-secondary {
+		padding: 0.375rem 0.75rem;
+		border-radius: 0.25rem;
+	}
+	.btn-primary {
+		background-color: blue;
+	}
+	.btn-secondary {
+		background-color: gray;
+	}
+	.btn-lg, .btn-group-lg > .btn {
+		padding: 0.5rem 1rem;
+		font-size: 1.25rem;
+	}
+	.btn-sm, .btn-group-sm > .btn {
+		padding: 0.25rem 0.5rem;
+		font-size: 0.875rem;
+	}
+	h1, .h1 {
+		font-size: 2.5rem;
+	}
+	.d-none, .hidden {
+		display: none;
+	}
+	.d-block {
+		display: block;
+	}
+	.placeholder\:text-gray::-moz-placeholder, .placeholder\:text-gray::placeholder {
+		color: gray;
+	}
+	.placeholder\:text-red::-moz-placeholder, .placeholder\:text-red::placeholder {
+		color: red;
+	}
+	`
+
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	if got := r.Rules()["btn-primary"]; len(got) != 2 {
+		t.Errorf("Rules has %d rules for btn-primary, want 2", len(got))
+	}
+	// .btn is the subject of .btn-group-lg > .btn, and btn-group-lg only its context
+	if got := r.Rules()["btn"]; len(got) != 2 {
+		t.Errorf("Rules has %d rules for btn, want 2", len(got))
+	}
+	if got := r.Rules()["btn-group-lg"]; len(got) != 0 {
+		t.Errorf("Rules has %d rules for btn-group-lg, want none", len(got))
+	}
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		{in: "btn-primary btn-secondary", want: "btn-secondary"},
+		{in: "btn-secondary btn-primary", want: "btn-primary"},
+		{in: "btn-primary btn-lg", want: "btn-primary btn-lg"},
+		{in: "btn-lg btn-sm", want: "btn-sm"},
+		{in: "btn-sm btn-lg", want: "btn-lg"},
+		{in: "h1 btn-sm", want: "btn-sm"},
+		{in: "btn-lg h1", want: "btn-lg h1"},
+		{in: "hidden d-block", want: "d-block"},
+		{in: "d-none hidden", want: "hidden"},
+		{in: "placeholder:text-gray placeholder:text-red", want: "placeholder:text-red"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			if got := r.Merge(tc.in); got != tc.want {
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeDirection(t *testing.T) {
+	rules := `
+	.p-2 {
+		padding: 0.5rem;
+	}
+	.px-2 {
+		padding-inline: 0.5rem;
+	}
+	.ps-4 {
+		padding-inline-start: 1rem;
+	}
+	.pl-2 {
+		padding-left: 0.5rem;
+	}
+	.pr-2 {
+		padding-right: 0.5rem;
+	}
+	.ms-2 {
+		margin-inline-start: 0.5rem;
+	}
+	.ml-4 {
+		margin-left: 1rem;
+	}
+	.rounded-s {
+		border-start-start-radius: 0.25rem;
+		border-end-start-radius: 0.25rem;
+	}
+	.rounded-l {
+		border-top-left-radius: 0.25rem;
+		border-bottom-left-radius: 0.25rem;
+	}
+	.border-x {
+		border-inline-width: 1px;
+	}
+	.border-l-2 {
+		border-left-width: 2px;
+	}
+	.w-4 {
+		width: 1rem;
+	}
+	.size-4 {
+		inline-size: 1rem;
+		block-size: 1rem;
+	}
+	`
+
+	tt := []struct {
+		dir  Direction
+		in   string
+		want string
+	}{
+		// logical properties conflict with each other in any direction
+		{dir: DirectionUnknown, in: "ps-4 px-2", want: "px-2"},
+		{dir: DirectionUnknown, in: "px-2 ps-4", want: "px-2 ps-4"},
+		// the side of a logical property is not known, unless every side is set
+		{dir: DirectionUnknown, in: "ps-4 pl-2", want: "ps-4 pl-2"},
+		{dir: DirectionUnknown, in: "pl-2 ps-4", want: "pl-2 ps-4"},
+		{dir: DirectionUnknown, in: "ps-4 p-2", want: "p-2"},
+		{dir: DirectionUnknown, in: "p-2 ps-4", want: "p-2 ps-4"},
+		// the dimensions of a box do not depend on the direction
+		{dir: DirectionUnknown, in: "w-4 size-4", want: "size-4"},
+		{dir: DirectionLTR, in: "ps-4 pl-2", want: "pl-2"},
+		{dir: DirectionLTR, in: "pl-2 ps-4", want: "ps-4"},
+		{dir: DirectionLTR, in: "ps-4 pr-2", want: "ps-4 pr-2"},
+		{dir: DirectionLTR, in: "ms-2 ml-4", want: "ml-4"},
+		{dir: DirectionLTR, in: "pl-2 pr-2 px-2", want: "px-2"},
+		{dir: DirectionLTR, in: "rounded-l rounded-s", want: "rounded-s"},
+		{dir: DirectionLTR, in: "border-l-2 border-x", want: "border-x"},
+		{dir: DirectionLTR, in: "w-4 size-4", want: "size-4"},
+		{dir: DirectionRTL, in: "ps-4 pl-2", want: "ps-4 pl-2"},
+		{dir: DirectionRTL, in: "ps-4 pr-2", want: "pr-2"},
+		{dir: DirectionRTL, in: "ms-2 ml-4", want: "ms-2 ml-4"},
+		{dir: DirectionRTL, in: "rounded-l rounded-s", want: "rounded-l rounded-s"},
+		{dir: DirectionRTL, in: "border-l-2 border-x", want: "border-x"},
+	}
+
+	r := NewMerger(NewCache(), true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	for _, tc := range tt {
+		// the cache is cleared when the direction is set
+		r.SetDirection(tc.dir)
+		if got := r.Merge(tc.in); got != tc.want {
+			t.Errorf("Merge(%q) with direction %d = %q, want %q", tc.in, tc.dir, got, tc.want)
+		}
+	}
+}
+
+// raceEnabled is set when the tests are run with the race detector (see race_test.go).
+var raceEnabled bool
+
+func TestMergeCustomPropertyChains(t *testing.T) {
+	rules := `
+	.ring {
+		--tw-ring-offset-shadow: var(--tw-ring-inset) 0 0 0 var(--tw-ring-offset-width) var(--tw-ring-offset-color);
+		--tw-ring-shadow: var(--tw-ring-inset) 0 0 0 calc(3px + var(--tw-ring-offset-width)) var(--tw-ring-color);
+		box-shadow: var(--tw-ring-offset-shadow), var(--tw-ring-shadow), var(--tw-shadow, 0 0 #0000);
+	}
+	.shadow {
+		--tw-shadow: 0 1px 3px 0 rgb(0 0 0 / 0.1);
+		box-shadow: var(--tw-ring-offset-shadow, 0 0 #0000), var(--tw-ring-shadow, 0 0 #0000), var(--tw-shadow);
+	}
+	.ring-red {
+		--tw-ring-color: red;
+	}
+	.ring-blue {
+		--tw-ring-color: blue;
+	}
+	.hover\:ring-red:hover {
+		--tw-ring-color: red;
+	}
+	.ring-offset-2 {
+		--tw-ring-offset-width: 2px;
+	}
+	.rotate-3 {
+		--tw-rotate: 3deg;
+		transform: translate(var(--tw-translate-x), var(--tw-translate-y)) rotate(var(--tw-rotate)) scale(var(--tw-scale-x));
+	}
+	.rotate-6 {
+		--tw-rotate: 6deg;
+		transform: translate(var(--tw-translate-x), var(--tw-translate-y)) rotate(var(--tw-rotate)) scale(var(--tw-scale-x));
+	}
+	.scale-50 {
+		--tw-scale-x: .5;
+		transform: translate(var(--tw-translate-x), var(--tw-translate-y)) rotate(var(--tw-rotate)) scale(var(--tw-scale-x));
+	}
+	.text-brand {
+		color: var(--brand, var(--accent));
+	}
+	.accent-red {
+		--accent: red;
+	}
+	.brand-nested {
+		--brand: var(--primary, var(--secondary));
+	}
+	.secondary-blue {
+		--secondary: blue;
+	}
+	.cycle-a {
+		--a: var(--b);
+	}
+	.cycle-b {
+		--b: var(--a);
+	}
+	.text-a {
+		color: var(--a);
+	}
+	.text-c {
+		color: var(--c);
+		--tw-text-opacity: 1;
+	}
+	.c-red {
+		--c: red;
+	}
+	.w-overridden {
+		width: var(--w);
+		width: 1rem;
+	}
+	.w-var {
+		--w: 2rem;
+	}
+	`
+
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	tt := []struct {
+		in   string
+		want string
+	}{
+		// box-shadow uses --tw-ring-shadow, which uses --tw-ring-color and --tw-ring-offset-width
+		{in: "ring ring-red", want: "ring ring-red"},
+		{in: "ring-red ring", want: "ring-red ring"},
+		{in: "ring-red ring-blue ring", want: "ring-blue ring"},
+		{in: "ring ring-offset-2", want: "ring ring-offset-2"},
+		{in: "ring hover:ring-red", want: "ring hover:ring-red"},
+		// no class sets --tw-ring-shadow, so --tw-ring-color does not affect the box-shadow of shadow
+		{in: "shadow ring-red", want: "shadow"},
+		{in: "ring-red ring-offset-2 scale-50", want: "scale-50"},
+		{in: "rotate-3 scale-50", want: "rotate-3 scale-50"},
+		{in: "rotate-3 rotate-6 scale-50", want: "rotate-6 scale-50"},
+		// the variables in fallbacks and nested var() are used
+		{in: "accent-red text-brand", want: "accent-red text-brand"},
+		{in: "secondary-blue brand-nested text-brand", want: "secondary-blue brand-nested text-brand"},
+		{in: "secondary-blue text-brand", want: "text-brand"},
+		{in: "cycle-a cycle-b text-a", want: "cycle-a cycle-b text-a"},
+		{in: "cycle-b text-a", want: "text-a"},
+		{in: "cycle-a cycle-b", want: ""},
+		// the uses of a property are the uses of the declaration that sets it last
+		{in: "c-red text-c", want: "c-red text-c"},
+		{in: "w-var w-overridden", want: "w-overridden"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			if got := r.Merge(tc.in); got != tc.want {
+				t.Errorf("Merge(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+			body := parseBody(t, `<div class="`+tc.in+`"></div>`)
+			r.MergeNode(body.FirstChild)
+			if got, _ := classAttr(body.FirstChild); got != tc.want {
+				t.Errorf("MergeNode(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeImportant(t *testing.T) {
+	tailwind := `
+	.p-2 {
+		padding: 0.5rem;
+	}
+	.p-4 {
+		padding: 1rem;
+	}
+	.px-2 {
+		padding-left: 0.5rem;
+		padding-right: 0.5rem;
+	}
+	.\!p-3 {
+		padding: 0.75rem !important;
+	}
+	.font-thin {
+		font-weight: 100;
+	}
+	.\!font-medium {
+		font-weight: 500 !important;
+	}
+	.\!font-bold {
+		font-weight: 700 !important;
+	}
+	.\!p-5 {
+		padding: 1.25rem !important;
+	}
+	.\!px-2 {
+		padding-left: 0.5rem !important;
+		padding-right: 0.5rem !important;
+	}
+	.hover\:\!p-3:hover {
+		padding: 0.75rem !important;
+	}
+	.ring {
+		--tw-ring-shadow: 0 0 0 3px var(--tw-ring-color);
+		box-shadow: var(--tw-ring-shadow);
+	}
+	.ring-blue {
+		--tw-ring-color: blue;
+	}
+	.\!ring-red {
+		--tw-ring-color: red !important;
+	}
+	`
+
+	// Bootstrap marks every utility !important, so utilities win over the components whatever the order of the classes
+	bootstrap := `
+	.btn {
+		display: inline-block;
+		padding: 0.375rem 0.75rem;
+		font-size: 1rem;
+	}
+	.p-0 {
+		padding: 0 !important;
+	}
+	.p-3 {
+		padding: 1rem !important;
+	}
+	.px-2 {
+		padding-right: 0.5rem !important;
+		padding-left: 0.5rem !important;
+	}
+	.d-none {
+		display: none !important;
+	}
+	.d-flex {
+		display: flex !important;
+	}
+	@media (min-width: 768px) {
+		.d-md-block {
+			display: block !important;
+		}
+	}
+	.fs-5 {
+		font-size: 1.25rem !important;
+	}
+	`
+
+	layers := `
+	@layer base, utilities;
+	@layer base {
+		.base-p-1 {
+			padding: 0.25rem !important;
+		}
+		.base-p-2 {
+			padding: 0.5rem;
+		}
+	}
+	@layer utilities {
+		.utilities-p-1 {
+			padding: 0.25rem !important;
+		}
+		.utilities-p-2 {
+			padding: 0.5rem;
+		}
+	}
+	.p-1 {
+		padding: 0.25rem !important;
+	}
+	`
+
+	tt := []struct {
+		name  string
+		rules string
+		tests []struct{ in, want string }
+	}{
+		{
+			name:  "tailwind",
+			rules: tailwind,
+			tests: []struct{ in, want string }{
+				{in: "p-2 !p-3", want: "!p-3"},
+				{in: "!p-3 p-4", want: "!p-3"},
+				{in: "!p-3 !p-5", want: "!p-5"},
+				{in: "!p-5 !p-3", want: "!p-3"},
+				{in: "!p-3 px-2", want: "!p-3"},
+				{in: "!px-2 p-4", want: "!px-2 p-4"},
+				{in: "p-4 hover:!p-3", want: "p-4 hover:!p-3"},
+				// unlike tailwind-merge, a class is removed if an !important class wins all its properties
+				{in: "!font-medium !font-bold font-thin", want: "!font-bold"},
+				{in: "font-thin !font-medium", want: "!font-medium"},
+				// an !important custom property wins over a later one, and is kept if it is used
+				{in: "ring !ring-red ring-blue", want: "ring !ring-red"},
+				{in: "!ring-red ring-blue ring", want: "!ring-red ring"},
+			},
+		},
+		{
+			name:  "bootstrap",
+			rules: bootstrap,
+			tests: []struct{ in, want string }{
+				{in: "p-0 btn", want: "p-0 btn"},
+				{in: "btn p-0 fs-5 d-none", want: "p-0 fs-5 d-none"},
+				{in: "p-3 p-0", want: "p-0"},
+				{in: "p-0 px-2", want: "p-0 px-2"},
+				{in: "px-2 p-0", want: "p-0"},
+				{in: "d-none d-flex", want: "d-flex"},
+				{in: "d-none d-md-block", want: "d-none d-md-block"},
+			},
+		},
+		{
+			name:  "layers",
+			rules: layers,
+			tests: []struct{ in, want string }{
+				// the order of the layers is reversed for !important declarations
+				{in: "base-p-1 utilities-p-1", want: "base-p-1"},
+				{in: "utilities-p-1 base-p-1", want: "base-p-1"},
+				{in: "utilities-p-1 p-1", want: "utilities-p-1"},
+				{in: "base-p-2 utilities-p-2", want: "utilities-p-2"},
+				{in: "utilities-p-2 base-p-2", want: "utilities-p-2"},
+				{in: "p-1 base-p-2", want: "p-1"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		r := NewMerger(nil, true)
+		err := r.AddRules(strings.NewReader(tc.rules), false)
+		if err != nil {
+			t.Fatalf("AddRules returned error: %v", err)
+		}
+		for _, test := range tc.tests {
+			t.Run(tc.name+"/"+test.in, func(t *testing.T) {
+				if got := r.Merge(test.in); got != test.want {
+					t.Errorf("Merge(%q) = %q, want %q", test.in, got, test.want)
+				}
+				body := parseBody(t, `<div class="`+test.in+`"></div>`)
+				r.MergeNode(body.FirstChild)
+				if got, _ := classAttr(body.FirstChild); got != test.want {
+					t.Errorf("MergeNode(%q) = %q, want %q", test.in, got, test.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMergeAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not counted with the race detector")
+	}
+	by, err := os.ReadFile("./internal/cascadia/test_resources/test_output.css")
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	by2, err := os.ReadFile("./internal/cascadia/test_resources/classList.txt")
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	classList := string(by2)
+
+	for _, keepSort := range []bool{false, true} {
+		r := NewMerger(nil, keepSort)
+		err = r.AddRules(bytes.NewBuffer(by), false)
+		if err != nil {
+			t.Fatalf("AddRules returned error: %v", err)
+		}
+		// the footprints are precompiled, so only the result is allocated
+		allocs := testing.AllocsPerRun(100, func() {
+			r.Merge(classList)
+		})
+		if allocs > 1 {
+			t.Errorf("Merge with keepSort %v allocated %v times, want at most 1", keepSort, allocs)
+		}
+	}
+}
+
+func TestAddRulesTransactional(t *testing.T) {
+	cache := NewCache()
+	r := NewMerger(cache, true)
+	err := r.AddRules(strings.NewReader(`.p-1 { padding: 0.25rem; } .p-2 { padding: 0.5rem; }`), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	if got := r.Merge("p-1 p-2"); got != "p-2" {
+		t.Fatalf("Merge returned %q, want %q", got, "p-2")
+	}
+
+	// a stylesheet that fails to parse changes nothing
+	err = r.AddRules(strings.NewReader(`.m-1 { margin: 0.25rem; } .m-2 { margin: 0.5rem; }}`), false)
+	if err == nil {
+		t.Fatal("AddRules returned no error")
+	}
+	if _, ok := r.Rules()["m-1"]; ok {
+		t.Error("AddRules added the rules of a stylesheet that failed to parse")
+	}
+	if _, ok := cache.Get("p-1 p-2"); !ok {
+		t.Error("AddRules cleared the cache for a stylesheet that failed to parse")
+	}
+
+	err = r.AddRules(strings.NewReader(`.m-1 { margin: 0.25rem; } .m-2 { margin: 0.5rem; }`), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	if _, ok := cache.Get("p-1 p-2"); ok {
+		t.Error("AddRules did not clear the cache")
+	}
+}
+
+// TestMergeConcurrentAddRules is meant to be run with -race.
+func TestMergeConcurrentAddRules(t *testing.T) {
+	r := NewMerger(NewCache(), true)
+	err := r.AddRules(strings.NewReader(`.p-1 { padding: 0.25rem; } .p-2 { padding: 0.5rem; }`), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	const reloads = 50
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if got := r.Merge("p-1 p-2"); got != "p-2" {
+					t.Errorf("Merge returned %q, want %q", got, "p-2")
+					return
+				}
+				// the margin rules are added while merging
+				if got := r.Merge("p-2 m-1 m-2"); got != "p-2 m-1 m-2" && got != "p-2 m-2" {
+					t.Errorf("Merge returned %q", got)
+					return
+				}
+				r.Explain("m-1 m-2")
+				_ = len(r.Rules())
+			}
+		}()
+	}
+
+	for i := 0; i < reloads; i++ {
+		err := r.AddRules(strings.NewReader(`@layer base { .m-1 { margin: 0.25rem; } } @layer base { .m-2 { margin: 0.5rem; } }`), false)
+		if err != nil {
+			t.Errorf("AddRules returned error: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// a result merged with the old rules is not left in the cache
+	if got := r.Merge("p-2 m-1 m-2"); got != "p-2 m-2" {
+		t.Errorf("Merge returned %q, want %q", got, "p-2 m-2")
 	}
 }
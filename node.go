@@ -0,0 +1,264 @@
+package merge
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+	"golang.org/x/net/html"
+)
+
+// MergeNode merges the classes of the class attribute of an element and updates the attribute.
+// Unlike Merge, which only sees a class list, the rules are matched against the document the element is in:
+//   - a rule that cannot apply to the element (e.g., ".class1 .class2" without a class1 ancestor) is ignored
+//   - a rule that applies wins over rules with a lower specificity, regardless of the position of its class.
+//     Between rules with the same specificity, the class that comes last in the attribute wins, like Merge.
+//   - a class the selector of a rule needs on another element (e.g., class1 of ".class1 .class2") is kept
+//   - a rule for the elements related to the element with its class (e.g., the children of space-x-2) is matched
+//     against the element with the class, since the elements it styles may be added later
+//
+// A state that cannot be read from the document (e.g., :hover or :checked) is assumed to be possible,
+// so it is part of the condition of a rule like the at-rules the rule is nested in.
+// A class is kept if none of its rules apply to the element, because the context it needs may be added later (e.g., by a script).
+// The element should be in its final place in the document, since removing it would change which rules apply.
+func (r *Merger) MergeNode(n *html.Node) {
+	if value, ok := r.mergeNode(r.rules.Load(), n); ok {
+		setClassAttr(n, value)
+	}
+}
+
+// MergeTree merges the class attribute of n and of every element under it (see MergeNode).
+// Every element is merged against the tree as it was before any attribute was changed.
+func (r *Merger) MergeTree(n *html.Node) {
+	type change struct {
+		n     *html.Node
+		value string
+	}
+	var changes []change
+	rs := r.rules.Load()
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if value, ok := r.mergeNode(rs, n); ok {
+			changes = append(changes, change{n: n, value: value})
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	for _, c := range changes {
+		setClassAttr(c.n, c.value)
+	}
+}
+
+// mergeNode returns the merged class attribute of n.
+// It returns false if n has no class attribute or if merging does not change it.
+func (r *Merger) mergeNode(rs *ruleSet, n *html.Node) (string, bool) {
+	if n.Type != html.ElementNode {
+		return "", false
+	}
+	value, ok := classAttr(n)
+	if !ok {
+		return "", false
+	}
+	split := strings.Fields(value)
+	if len(split) < 2 {
+		return "", false
+	}
+	merged := r.join(split, r.resolveNode(rs, n, split))
+	if merged == strings.Join(split, " ") {
+		return "", false
+	}
+	return merged, true
+}
+
+// nodeDeclaration is a declaration of a rule that applies to an element.
+type nodeDeclaration struct {
+	property   string
+	classes    []string // the classes of the element that own the rule (see ruleOwner)
+	rank       cascadeRank
+	position   int      // the position of the last of classes in the class attribute
+	customVars []string // custom properties used in the value
+}
+
+// beats returns whether d wins over o in the cascade.
+// The class that comes last in the class attribute wins a tie, like in Merge.
+func (d nodeDeclaration) beats(o nodeDeclaration) bool {
+	c := d.rank.compare(o.rank)
+	return c > 0 || c == 0 && d.position >= o.position
+}
+
+// resolveNode returns the classes of split that are kept on the element n.
+func (r *Merger) resolveNode(rs *ruleSet, n *html.Node, split []string) []string {
+	positions := make(map[string]int, len(split))
+	for i, class := range split {
+		positions[class] = i
+	}
+
+	keep := make([]string, 0, len(split))
+	applied := make(map[string]bool, len(split))            // classes with a rule that applies to n
+	winners := make(map[string]nodeDeclaration, len(split)) // the winning declaration of each property and condition
+	for class := range positions {
+		rules, ok := rs.rules[class]
+		if !ok {
+			keep = append(keep, class)
+			continue
+		}
+		for _, rule := range rules {
+			// a rule that styles the elements related to its owner (e.g., the children of space-x-2) is matched against the owner,
+			// since the elements it styles may be added later
+			owner, owners, styled := ruleOwner(rule.Selector)
+			if !cascadia.MayMatch(owner, n) {
+				continue
+			}
+			applied[class] = true
+
+			// a rule with more than one class (e.g., .a.b) is resolved for each of them, with the same outcome
+			var classes []string
+			position := 0
+			for _, c := range owners {
+				if p, ok := positions[c]; ok && !slices.Contains(classes, c) {
+					classes = append(classes, c)
+					if p > position {
+						position = p
+					}
+				}
+			}
+			condition := nodeCondition(rule, owner, styled)
+			for _, dec := range rule.Declarations {
+				d := nodeDeclaration{
+					classes:    classes,
+					rank:       cascadeRank{important: dec.Important, layer: rs.layers.get(rule.GetLayer()), specificity: rule.Selector.Specificity()},
+					position:   position,
+					customVars: getCustomVarsInDec(dec),
+				}
+				for _, prop := range r.appendDeclarationProps(nil, dec, rs.direction) {
+					d.property = prop
+					key := prop + condition
+					if w, ok := winners[key]; !ok || d.beats(w) {
+						winners[key] = d
+					}
+				}
+			}
+		}
+		if !applied[class] {
+			keep = append(keep, class)
+		}
+	}
+
+	// keep the classes of the winning declarations, and the classes that set a custom property
+	// only if a winning declaration uses it, directly or through other custom properties
+	usedVars := make(map[string]bool)
+	var pending []string
+	for _, d := range winners {
+		if strings.HasPrefix(d.property, "--") {
+			continue
+		}
+		keep = append(keep, d.classes...)
+		pending = append(pending, d.customVars...)
+	}
+	for len(pending) > 0 {
+		v := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if usedVars[v] {
+			continue
+		}
+		usedVars[v] = true
+		for _, d := range winners {
+			if d.property == v {
+				keep = append(keep, d.classes...)
+				pending = append(pending, d.customVars...)
+			}
+		}
+	}
+
+	keep = unique(keep)
+	for class := range applied {
+		if _, ok := slices.BinarySearch(keep, class); !ok && rs.isContext(class, n) {
+			keep = append(keep, class)
+		}
+	}
+	return unique(keep)
+}
+
+// isContext returns whether class is needed by the selector of a rule that may apply to an element
+// of the document n is in (e.g., class1 of ".class1 .class2").
+func (rs *ruleSet) isContext(class string, n *html.Node) bool {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	for _, rule := range rs.contexts[class] {
+		owner, _, _ := ruleOwner(rule.Selector)
+		if mayMatchTree(owner, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatchTree returns whether sel may match n or an element under it (see cascadia.MayMatch).
+func mayMatchTree(sel cascadia.Sel, n *html.Node) bool {
+	if n.Type == html.ElementNode && cascadia.MayMatch(sel, n) {
+		return true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if mayMatchTree(sel, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeCondition returns the circumstance in which a rule that applies to an element takes effect.
+// It is the chain of at-rules the rule is nested in, followed by the parts of the owner (see ruleOwner) that depend on a state
+// (e.g., ".group:hover" for ".group:hover .item" or ":focus" for ".item:focus"), the pseudo-element of the rule
+// and the elements the rule styles, if they are not the owner.
+// The other parts of the owner are left out because they were matched against the document.
+func nodeCondition(rule cascadia.CssRule, owner cascadia.Sel, styled string) string {
+	condition := atRuleCondition(rule)
+	sel := owner
+	if t, ok := sel.(cascadia.CombinedSelector); ok && t.Second() != nil {
+		if cascadia.IsDynamic(t.First()) {
+			condition += " " + t.First().String()
+		}
+		sel = t.Second()
+	}
+
+	var states []string
+	if t, ok := sel.(cascadia.CompoundSelector); ok {
+		for _, s := range t.Selectors() {
+			if cascadia.IsDynamic(s) {
+				states = append(states, s.String())
+			}
+		}
+		if pseudo := t.PseudoElement(); pseudo != "" {
+			states = append(states, "::"+pseudo)
+		}
+	} else if cascadia.IsDynamic(sel) {
+		states = append(states, sel.String())
+	}
+	// the order of the states does not matter (e.g., :hover:focus and :focus:hover)
+	slices.Sort(states)
+	return condition + " " + strings.Join(states, "") + " " + styled
+}
+
+// classAttr returns the value of the class attribute of n.
+func classAttr(n *html.Node) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == "class" {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// setClassAttr sets the value of the class attribute of n.
+func setClassAttr(n *html.Node, value string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == "class" {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+}
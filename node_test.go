@@ -0,0 +1,206 @@
+package merge
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const nodeRules = `
+.class1 .class2 {
+	padding: 10px;
+}
+.class3 {
+	padding: 20px;
+}
+.p-1 {
+	padding: 0.25rem;
+}
+.p-2 {
+	padding: 0.5rem;
+}
+.hover\:p-2:hover {
+	padding: 0.5rem;
+}
+.group:hover .group-hover\:p-2 {
+	padding: 0.5rem;
+}
+.card {
+	padding: 1rem;
+}
+.card .title {
+	font-weight: 700;
+}
+.font-normal {
+	font-weight: 400;
+}
+:is(.btn-a, .btn-b) {
+	padding: 2px;
+}
+.space-x-2 > :not([hidden]) ~ :not([hidden]) {
+	margin-left: 0.5rem;
+}
+.space-x-16 > :not([hidden]) ~ :not([hidden]) {
+	margin-left: 4rem;
+}
+.divide-x > :not([hidden]) ~ :not([hidden]) {
+	border-left-width: 1px;
+}
+.divide-x-2 > :not([hidden]) ~ :not([hidden]) {
+	border-left-width: 2px;
+}
+.ml-2 {
+	margin-left: 0.5rem;
+}
+.space-y-2 {
+	:where(& > :not(:last-child)) {
+		margin-bottom: 0.5rem;
+	}
+}
+.space-y-4 {
+	:where(& > :not(:last-child)) {
+		margin-bottom: 1rem;
+	}
+}
+`
+
+func TestMergeTree(t *testing.T) {
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(nodeRules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	tt := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "conflict",
+			in:   `<p class="p-1 p-2"></p>`,
+			want: `<p class="p-2"></p>`,
+		},
+		{
+			name: "more specific rule applies",
+			in:   `<div class="class1"><p class="class2 class3"></p></div>`,
+			want: `<div class="class1"><p class="class2"></p></div>`,
+		},
+		{
+			name: "more specific rule does not apply",
+			in:   `<div><p class="class2 class3"></p></div>`,
+			want: `<div><p class="class2 class3"></p></div>`,
+		},
+		{
+			name: "more specific rule applies before a later class",
+			in:   `<div class="class1"><p class="class2 p-1 class3"></p></div>`,
+			want: `<div class="class1"><p class="class2"></p></div>`,
+		},
+		{
+			name: "state",
+			in:   `<p class="p-1 hover:p-2 p-2"></p>`,
+			want: `<p class="hover:p-2 p-2"></p>`,
+		},
+		{
+			name: "ancestor state",
+			in:   `<div class="group"><p class="p-1 group-hover:p-2"></p></div>`,
+			want: `<div class="group"><p class="p-1 group-hover:p-2"></p></div>`,
+		},
+		{
+			name: "context class is kept",
+			in:   `<div class="card p-2"><h2 class="title font-normal"></h2></div>`,
+			want: `<div class="card p-2"><h2 class="title"></h2></div>`,
+		},
+		{
+			name: "context class without context",
+			in:   `<div class="card p-2"><h2 class="font-normal"></h2></div>`,
+			want: `<div class="p-2"><h2 class="font-normal"></h2></div>`,
+		},
+		{
+			name: "classes in :is() own the rule",
+			in:   `<p class="btn-a p-1"></p>`,
+			want: `<p class="p-1"></p>`,
+		},
+		{
+			name: "rules for the children belong to the element",
+			in:   `<div class="space-x-16 space-x-2 divide-x-2 divide-x"><p></p><p></p></div>`,
+			want: `<div class="space-x-2 divide-x"><p></p><p></p></div>`,
+		},
+		{
+			name: "rules for the children without children",
+			in:   `<div class="space-x-16 space-x-2"></div>`,
+			want: `<div class="space-x-2"></div>`,
+		},
+		{
+			name: "rules for the children in :where()",
+			in:   `<div class="space-y-4 space-y-2"><p class="space-y-4"></p></div>`,
+			want: `<div class="space-y-2"><p class="space-y-4"></p></div>`,
+		},
+		{
+			name: "rules for the children do not style the element",
+			in:   `<div class="space-x-2 ml-2"><p class="ml-2 p-1"></p></div>`,
+			want: `<div class="space-x-2 ml-2"><p class="ml-2 p-1"></p></div>`,
+		},
+		{
+			name: "unknown classes",
+			in:   `<p class="unknown p-1 p-2 unknown"></p>`,
+			want: `<p class="p-2 unknown"></p>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			body := parseBody(t, tc.in)
+			r.MergeTree(body)
+			if got := renderChildren(t, body); got != tc.want {
+				t.Errorf("MergeTree rendered %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeNode(t *testing.T) {
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(nodeRules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	// only the element is merged
+	body := parseBody(t, `<div class="class1 p-1 p-2"><p class="class2 class3">text</p></div>`)
+	p := body.FirstChild.FirstChild
+	r.MergeNode(p)
+	want := `<div class="class1 p-1 p-2"><p class="class2">text</p></div>`
+	if got := renderChildren(t, body); got != want {
+		t.Errorf("MergeNode rendered %q, want %q", got, want)
+	}
+
+	// text nodes and elements without a class attribute are left alone
+	r.MergeNode(body)
+	r.MergeNode(p.FirstChild)
+	if got := renderChildren(t, body); got != want {
+		t.Errorf("MergeNode rendered %q, want %q", got, want)
+	}
+}
+
+func parseBody(t *testing.T, s string) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader("<html><body>" + s + "</body></html>"))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	return doc.FirstChild.LastChild
+}
+
+func renderChildren(t *testing.T, n *html.Node) string {
+	t.Helper()
+	b := &bytes.Buffer{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(b, c); err != nil {
+			t.Fatalf("Render returned error: %v", err)
+		}
+	}
+	return b.String()
+}
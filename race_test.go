@@ -0,0 +1,8 @@
+//go:build race
+
+package merge
+
+func init() {
+	// the race detector makes sync.Pool drop items at random, so allocations cannot be counted
+	raceEnabled = true
+}
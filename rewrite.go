@@ -0,0 +1,225 @@
+package merge
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RewriteHTML streams an HTML document from src to w and merges the classes of every class attribute.
+// Everything else, including class attributes that do not change, is written byte-for-byte.
+func (r *Merger) RewriteHTML(w io.Writer, src io.Reader) error {
+	z := html.NewTokenizer(src)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+			return nil
+		}
+		raw := z.Raw()
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			raw = r.rewriteTag(raw)
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// HTMLWriter returns a writer that merges the classes of the HTML written to it and writes the result to w.
+// Close must be called to flush the rest of the document. It returns the first error encountered.
+func (r *Merger) HTMLWriter(w io.Writer) io.WriteCloser {
+	pr, pw := io.Pipe()
+	hw := &htmlWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := r.RewriteHTML(w, pr)
+		// unblock the writer if the rewrite stopped early
+		pr.CloseWithError(err)
+		hw.done <- err
+	}()
+	return hw
+}
+
+type htmlWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *htmlWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *htmlWriter) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Middleware returns a handler that merges the classes of the HTML responses of next.
+// Responses that are not text/html, or that are encoded (e.g., gzip), are passed through unchanged.
+func (r *Merger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hw := &htmlResponseWriter{ResponseWriter: w, merger: r}
+		next.ServeHTTP(hw, req)
+		if err := hw.close(); err != nil {
+			log.Println("error rewriting html:", err)
+		}
+	})
+}
+
+// htmlResponseWriter decides whether to rewrite a response when the handler writes the body,
+// because the content type may be sniffed from the first bytes like net/http does.
+type htmlResponseWriter struct {
+	http.ResponseWriter
+	merger   *Merger
+	status   int
+	decided  bool
+	rewriter io.WriteCloser // nil if the response is not rewritten
+}
+
+func (w *htmlResponseWriter) WriteHeader(code int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *htmlResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.decide(p)
+	}
+	if w.rewriter != nil {
+		return w.rewriter.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the original ResponseWriter for http.ResponseController.
+func (w *htmlResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *htmlResponseWriter) decide(p []byte) {
+	w.decided = true
+	header := w.Header()
+	contentType := header.Get("Content-Type")
+	if contentType == "" && len(p) > 0 {
+		contentType = http.DetectContentType(p)
+		header.Set("Content-Type", contentType)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "text/html" && header.Get("Content-Encoding") == "" {
+		// merging changes the length of the body
+		header.Del("Content-Length")
+		w.rewriter = w.merger.HTMLWriter(w.ResponseWriter)
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *htmlResponseWriter) close() error {
+	if !w.decided {
+		w.decide(nil)
+	}
+	if w.rewriter != nil {
+		return w.rewriter.Close()
+	}
+	return nil
+}
+
+// rewriteTag merges the classes of the class attribute of a raw start tag.
+// The tag is returned unchanged if it has no class attribute or if merging does not change it.
+func (r *Merger) rewriteTag(raw []byte) []byte {
+	start, end, ok := classAttrValue(raw)
+	if !ok {
+		return raw
+	}
+	// an unquoted value cannot hold spaces, so only quoted values hold more than one class
+	classes := strings.Fields(html.UnescapeString(string(raw[start:end])))
+	if len(classes) < 2 {
+		return raw
+	}
+	joined := strings.Join(classes, " ")
+	merged := r.Merge(joined)
+	if merged == joined {
+		return raw
+	}
+
+	out := make([]byte, 0, len(raw))
+	out = append(out, raw[:start]...)
+	out = append(out, html.EscapeString(merged)...)
+	out = append(out, raw[end:]...)
+	return out
+}
+
+// classAttrValue finds the value of the first class attribute in a raw start tag.
+// It returns the offsets of the value, without quotes.
+// The attributes are scanned like the tokenizer of golang.org/x/net/html does.
+func classAttrValue(raw []byte) (start int, end int, ok bool) {
+	i := 1 // skip <
+	// tag name
+	for i < len(raw) && !isHTMLSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' {
+		i++
+	}
+	for i < len(raw) {
+		// skip whitespace and stray slashes between attributes
+		for i < len(raw) && (isHTMLSpace(raw[i]) || raw[i] == '/') {
+			i++
+		}
+		if i >= len(raw) || raw[i] == '>' {
+			return 0, 0, false
+		}
+		nameStart := i
+		i++ // the first character of a name can be =
+		for i < len(raw) && !isHTMLSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' && raw[i] != '=' {
+			i++
+		}
+		name := raw[nameStart:i]
+		for i < len(raw) && isHTMLSpace(raw[i]) {
+			i++
+		}
+		if i >= len(raw) || raw[i] != '=' {
+			// attribute without a value
+			continue
+		}
+		i++
+		for i < len(raw) && isHTMLSpace(raw[i]) {
+			i++
+		}
+		if i >= len(raw) {
+			return 0, 0, false
+		}
+		var valueStart, valueEnd int
+		if q := raw[i]; q == '"' || q == '\'' {
+			valueStart = i + 1
+			valueEnd = bytes.IndexByte(raw[valueStart:], q)
+			if valueEnd < 0 {
+				return 0, 0, false
+			}
+			valueEnd += valueStart
+			i = valueEnd + 1
+		} else {
+			valueStart = i
+			for i < len(raw) && !isHTMLSpace(raw[i]) && raw[i] != '>' {
+				i++
+			}
+			valueEnd = i
+		}
+		if bytes.EqualFold(name, []byte("class")) {
+			return valueStart, valueEnd, true
+		}
+	}
+	return 0, 0, false
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r' || c == '\f'
+}
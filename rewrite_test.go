@@ -0,0 +1,206 @@
+package merge
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const rewriteRules = `
+.p-1 {
+	padding: 0.25rem;
+}
+.p-2 {
+	padding: 0.5rem;
+}
+.bg-red {
+	background-color: red;
+}
+.bg-blue {
+	background-color: blue;
+}
+`
+
+func newRewriteMerger(t *testing.T) *Merger {
+	t.Helper()
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(rewriteRules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	return r
+}
+
+func TestRewriteHTML(t *testing.T) {
+	r := newRewriteMerger(t)
+
+	tt := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "double quotes",
+			in:   `<div id="a" class="p-1 bg-red p-2" data-x='1'>text</div>`,
+			want: `<div id="a" class="bg-red p-2" data-x='1'>text</div>`,
+		},
+		{
+			name: "single quotes",
+			in:   `<div class='p-1  p-2'></div>`,
+			want: `<div class='p-2'></div>`,
+		},
+		{
+			name: "unquoted",
+			in:   `<div class=p-1 title=x></div><br class=p-2>`,
+			want: `<div class=p-1 title=x></div><br class=p-2>`,
+		},
+		{
+			name: "entities",
+			in:   `<div class="p-1&#32;p-2"></div>`,
+			want: `<div class="p-2"></div>`,
+		},
+		{
+			name: "self closing and upper case",
+			in:   `<IMG CLASS = "bg-red bg-blue" />`,
+			want: `<IMG CLASS = "bg-blue" />`,
+		},
+		{
+			name: "unchanged attribute is kept as written",
+			in:   "<div class=\"  p-1\n bg-red \"></div>",
+			want: "<div class=\"  p-1\n bg-red \"></div>",
+		},
+		{
+			name: "only the first class attribute",
+			in:   `<div class="p-1 p-2" class="p-1 p-2"></div>`,
+			want: `<div class="p-2" class="p-1 p-2"></div>`,
+		},
+		{
+			name: "class in an attribute value",
+			in:   `<div title='class="p-1 p-2"' class="p-1 p-2"></div>`,
+			want: `<div title='class="p-1 p-2"' class="p-2"></div>`,
+		},
+		{
+			name: "raw text and comments",
+			in:   `<!DOCTYPE html><!-- <div class="p-1 p-2"> --><script>let s = '<div class="p-1 p-2">';</script><textarea><p class="p-1 p-2"></textarea>`,
+			want: `<!DOCTYPE html><!-- <div class="p-1 p-2"> --><script>let s = '<div class="p-1 p-2">';</script><textarea><p class="p-1 p-2"></textarea>`,
+		},
+		{
+			name: "escaped result",
+			in:   `<div class="p-1 p-2 a&quot;b"></div>`,
+			want: `<div class="p-2 a&#34;b"></div>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			err := r.RewriteHTML(b, strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatalf("RewriteHTML returned error: %v", err)
+			}
+			if b.String() != tc.want {
+				t.Errorf("RewriteHTML wrote %q, want %q", b.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestRewriteHTMLPreservesDocuments(t *testing.T) {
+	// without rules only duplicate classes are dropped, and these documents have none,
+	// so they are written byte-for-byte
+	r := NewMerger(nil, true)
+	for _, file := range []string{"shakespeare.html", "content.xhtml"} {
+		t.Run(file, func(t *testing.T) {
+			by, err := os.ReadFile("./internal/cascadia/test_resources/" + file)
+			if err != nil {
+				t.Fatalf("ReadFile returned error: %v", err)
+			}
+			b := &bytes.Buffer{}
+			err = r.RewriteHTML(b, bytes.NewReader(by))
+			if err != nil {
+				t.Fatalf("RewriteHTML returned error: %v", err)
+			}
+			if !bytes.Equal(b.Bytes(), by) {
+				t.Errorf("RewriteHTML changed the document")
+			}
+		})
+	}
+}
+
+func TestHTMLWriter(t *testing.T) {
+	r := newRewriteMerger(t)
+	in := `<html><body><div class="p-1 p-2">a</div><span class="bg-red bg-blue">b</span></body></html>`
+	want := `<html><body><div class="p-2">a</div><span class="bg-blue">b</span></body></html>`
+
+	b := &bytes.Buffer{}
+	w := r.HTMLWriter(b)
+	// write in small chunks that split tags and attributes
+	for i := 0; i < len(in); i += 7 {
+		end := i + 7
+		if end > len(in) {
+			end = len(in)
+		}
+		if _, err := io.WriteString(w, in[i:end]); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if b.String() != want {
+		t.Errorf("HTMLWriter wrote %q, want %q", b.String(), want)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := newRewriteMerger(t)
+	page := `<!DOCTYPE html><html><body><div class="p-1 p-2">a</div></body></html>`
+
+	tt := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		want        string
+	}{
+		{name: "html", contentType: "text/html; charset=utf-8", body: page, want: `<!DOCTYPE html><html><body><div class="p-2">a</div></body></html>`},
+		{name: "sniffed html", body: page, want: `<!DOCTYPE html><html><body><div class="p-2">a</div></body></html>`},
+		{name: "json", contentType: "application/json", body: `{"html":"<div class=\"p-1 p-2\">"}`, want: `{"html":"<div class=\"p-1 p-2\">"}`},
+		{name: "encoded", contentType: "text/html", encoding: "identity-test", body: page, want: page},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				if tc.encoding != "" {
+					w.Header().Set("Content-Encoding", tc.encoding)
+				}
+				w.Header().Set("Content-Length", "1000")
+				w.WriteHeader(http.StatusCreated)
+				// the content type is sniffed from the first write
+				io.WriteString(w, tc.body[:len(tc.body)/2])
+				io.WriteString(w, tc.body[len(tc.body)/2:])
+			}))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != http.StatusCreated {
+				t.Errorf("got status %d, want %d", rec.Code, http.StatusCreated)
+			}
+			if rec.Body.String() != tc.want {
+				t.Errorf("got body %q, want %q", rec.Body.String(), tc.want)
+			}
+			rewritten := tc.want != tc.body
+			if got := rec.Header().Get("Content-Length"); rewritten == (got != "") {
+				t.Errorf("got Content-Length %q, rewritten %v", got, rewritten)
+			}
+		})
+	}
+}
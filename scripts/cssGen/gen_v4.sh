@@ -0,0 +1,27 @@
+#!/bin/sh
+# Regenerates internal/cascadia/test_resources/test_output_v4.css with the Tailwind v4 standalone CLI
+# and runs the tests. Run it from the root of the repository.
+set -eu
+
+version="${TAILWIND_VERSION:-latest}"
+os="$(uname -s | tr '[:upper:]' '[:lower:]')"
+case "$os" in
+darwin) os=macos ;;
+esac
+arch="$(uname -m)"
+case "$arch" in
+x86_64 | amd64) arch=x64 ;;
+aarch64) arch=arm64 ;;
+esac
+
+cli="$(mktemp -d)/tailwindcss"
+if [ "$version" = latest ]; then
+	url="https://github.com/tailwindlabs/tailwindcss/releases/latest/download/tailwindcss-$os-$arch"
+else
+	url="https://github.com/tailwindlabs/tailwindcss/releases/download/$version/tailwindcss-$os-$arch"
+fi
+curl -sSfL -o "$cli" "$url"
+chmod +x "$cli"
+
+"$cli" -i scripts/cssGen/input.v4.css -o internal/cascadia/test_resources/test_output_v4.css
+go test ./...
@@ -0,0 +1,637 @@
+package merge
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+	"github.com/tylantz/go-tailwind-merge/internal/props"
+)
+
+// SetTailwindFallback sets whether Merge infers what a class that is not in the rules sets from its Tailwind name.
+// Without the fallback, a class that is not in the rules is always kept, so classes that were purged or not generated yet
+// (e.g., p-[13px], bg-[#123456], [mask-type:luminance] or hover:!p-3) never conflict with anything.
+//
+// With the fallback, the name of such a class is parsed as a Tailwind class: its variants (hover:, md:, [&>*]:),
+// the important modifier (!p-3 or p-3!), a negative value (-m-2), an arbitrary value (p-[13px]), an arbitrary property ([mask-type:luminance])
+// and a modifier (bg-red-500/50). The properties are those of the class without its variants and modifiers if that class is in the rules
+// (e.g., p-3 for hover:!p-3), and otherwise those of the Tailwind utility it is named after (e.g., padding for p-[13px]).
+// The condition, the layer and the specificity of a variant are learned from the classes in the rules that use the same variants,
+// so hover:p-[13px] conflicts with hover:p-2. Variants that no class in the rules uses only conflict with the same variants of other inferred classes.
+// A class that cannot be inferred is kept, as without the fallback.
+//
+// The fallback is used by Merge and Explain, but not by MergeNode and MergeTree. Setting it clears the cache.
+func (r *Merger) SetTailwindFallback(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tailwindFallback = enabled
+	r.publish(r.rules.Load().clone())
+}
+
+// tailwindFallback is what a rule set needs to infer the footprint of a class from its Tailwind name (see SetTailwindFallback).
+type tailwindFallback struct {
+	properties map[string]props.Property
+	variants   map[string]variantSetting // the setting of each chain of variants (e.g., "md:hover"), learned from the rules
+}
+
+// variantSetting is where a chain of variants puts the rules of a class.
+type variantSetting struct {
+	condition   Condition
+	layer       int
+	specificity cascadia.Specificity
+}
+
+// variantKey is a variantSetting that can be compared and used as a map key.
+type variantKey struct {
+	condition   string // the normal form of the condition (see Condition.String)
+	layer       int
+	specificity cascadia.Specificity
+}
+
+func (v variantSetting) key() variantKey {
+	return variantKey{condition: v.condition.String(), layer: v.layer, specificity: v.specificity}
+}
+
+// compare orders variant settings so that the most common setting of a chain is chosen the same way every time.
+func (v variantKey) compare(o variantKey) int {
+	if c := cmp.Compare(v.condition, o.condition); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.layer, o.layer); c != 0 {
+		return c
+	}
+	for i := range v.specificity {
+		if c := cmp.Compare(v.specificity[i], o.specificity[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// newTailwindFallback learns the setting of each chain of variants from the classes of a rule set.
+// A class counts for its chain if all its rules have the same setting, and the most common setting of a chain is used.
+func (r *Merger) newTailwindFallback(rs *ruleSet) *tailwindFallback {
+	counts := make(map[string]map[variantKey]int)
+	settings := make(map[variantKey]variantSetting)
+	for class, rules := range rs.rules {
+		c, ok := parseTailwindClass(class)
+		if !ok {
+			continue
+		}
+		var key variantKey
+		for i, rule := range rules {
+			s := variantSetting{
+				condition:   newCondition(class, rule),
+				layer:       rs.layers.get(rule.GetLayer()),
+				specificity: rule.Selector.Specificity(),
+			}
+			k := s.key()
+			if i > 0 && k != key {
+				ok = false
+				break
+			}
+			key = k
+			settings[k] = s
+		}
+		if !ok {
+			continue
+		}
+		chain := strings.Join(c.variants, ":")
+		if counts[chain] == nil {
+			counts[chain] = make(map[variantKey]int)
+		}
+		counts[chain][key]++
+	}
+
+	f := &tailwindFallback{properties: r.properties, variants: make(map[string]variantSetting, len(counts))}
+	for chain, keys := range counts {
+		best, n := variantKey{}, 0
+		for k, count := range keys {
+			if count > n || count == n && k.compare(best) < 0 {
+				best, n = k, count
+			}
+		}
+		f.variants[chain] = settings[best]
+	}
+	return f
+}
+
+// footprint returns the footprint of a class, and whether it is known or could be inferred (see SetTailwindFallback).
+// An inferred footprint is kept in res until it is returned to the pool, so it is only inferred once per merge.
+func (rs *ruleSet) footprint(res *resolution, class string) (footprint, bool) {
+	if fp, ok := rs.footprints[class]; ok {
+		return fp, true
+	}
+	if rs.fallback == nil {
+		return nil, false
+	}
+	if fp, ok := res.inferred[class]; ok {
+		return fp, fp != nil
+	}
+	fp := rs.infer(res, class)
+	if res.inferred == nil {
+		res.inferred = make(map[string]footprint)
+	}
+	res.inferred[class] = fp
+	return fp, fp != nil
+}
+
+// infer returns the footprint of a class that is not in the rules from its Tailwind name, or nil if it cannot be inferred.
+func (rs *ruleSet) infer(res *resolution, class string) footprint {
+	c, ok := parseTailwindClass(class)
+	if !ok {
+		return nil
+	}
+	chain := strings.Join(c.variants, ":")
+	v, ok := rs.fallback.variants[chain]
+	if !ok {
+		v = variantSetting{layer: rs.layers.get(""), specificity: cascadia.Specificity{0, 1, 0}}
+		if chain != "" {
+			// a condition that no rule has, so the class only conflicts with inferred classes with the same variants
+			v.condition = Condition{variants: chain}
+		}
+	}
+
+	var fp footprint
+	if base, ok := rs.footprints[c.base]; ok && c.base != class {
+		// the class without its variants and modifiers is in the rules (e.g., p-3 for hover:!p-3)
+		for _, s := range base {
+			if !rs.keys.keys[s.key].condition.IsZero() {
+				continue
+			}
+			fp = append(fp, classSetting{
+				key:         res.keyID(rs, rs.keys.keys[s.key].property, v.condition),
+				custom:      s.custom,
+				layer:       v.layer,
+				specificity: v.specificity,
+				important:   s.important || c.important,
+				uses:        s.uses,
+			})
+		}
+		return fp
+	}
+
+	properties := c.properties()
+	for _, prop := range properties {
+		for _, computed := range rs.fallback.computed(prop, rs.direction) {
+			fp = append(fp, classSetting{
+				key: res.keyID(rs, computed, v.condition),
+				// an inferred custom property (e.g., [--gap:1rem]) is treated like any other property,
+				// because whether it is used cannot be inferred and the class would be dropped if it is not
+				custom:      false,
+				layer:       v.layer,
+				specificity: v.specificity,
+				important:   c.important,
+			})
+		}
+	}
+	return fp
+}
+
+// computed returns the properties a property is computed to (see Merger.appendDeclarationProps).
+func (f *tailwindFallback) computed(property string, dir Direction) []string {
+	computed := []string{property}
+	if p, ok := f.properties[property]; ok {
+		computed = p.ComputedProps()
+	}
+	return props.ResolveLogical(computed, dir.propsDirection())
+}
+
+// keyID returns the key of a property and a condition for an inferred footprint.
+// A key that no rule sets is only added to res, because the key table of a rule set is not changed once it is in use.
+func (res *resolution) keyID(rs *ruleSet, property string, condition Condition) int {
+	if id, ok := rs.keys.ids[property+condition.String()]; ok {
+		return id
+	}
+	id := slices.IndexFunc(res.extraKeys, func(k propertyKey) bool {
+		return k.property == property && k.condition.Equal(condition)
+	})
+	if id < 0 {
+		// a custom property that no rule sets without a condition is not used by any rule
+		variable := -1
+		if v, ok := rs.keys.ids[property]; ok && strings.HasPrefix(property, "--") {
+			variable = v
+		}
+		res.extraKeys = append(res.extraKeys, propertyKey{property: property, condition: condition, variable: variable})
+		id = len(res.extraKeys) - 1
+	}
+	id += len(rs.keys.keys)
+	if id >= len(res.slots) {
+		res.slots = append(res.slots, make([]int32, id+1-len(res.slots))...)
+	}
+	return id
+}
+
+// key returns the property and the condition of a key, including the keys of inferred footprints (see keyID).
+func (rs *ruleSet) key(res *resolution, id int) propertyKey {
+	if id < len(rs.keys.keys) {
+		return rs.keys.keys[id]
+	}
+	return res.extraKeys[id-len(rs.keys.keys)]
+}
+
+// tailwindClass is a class name parsed with the Tailwind syntax.
+// For "md:hover:!-mt-[3px]/50": variants are "md" and "hover", important and negative are true,
+// root is "mt", value is "3px", arbitrary is true, modifier is "50" and base is "-mt-[3px]/50".
+type tailwindClass struct {
+	variants  []string
+	important bool
+	negative  bool
+	base      string // the class without its variants and the important modifier
+	root      string // the utility (e.g., "p" or "bg"), or the property of an arbitrary property
+	value     string // the value, without brackets if it is arbitrary
+	arbitrary bool   // the value is in brackets (e.g., p-[13px])
+	property  bool   // the class is an arbitrary property (e.g., [mask-type:luminance])
+	modifier  string // the part after a slash (e.g., "50" for bg-red-500/50)
+}
+
+// parseTailwindClass parses a class name with the Tailwind syntax.
+// It returns false if the class is not a valid Tailwind class name (e.g., unbalanced brackets).
+func parseTailwindClass(class string) (tailwindClass, bool) {
+	var c tailwindClass
+	parts, ok := splitTopLevel(class, ':')
+	if !ok {
+		return c, false
+	}
+	if len(parts) > 1 {
+		c.variants = parts[:len(parts)-1]
+	}
+	for _, v := range c.variants {
+		if v == "" {
+			return c, false
+		}
+	}
+
+	u := parts[len(parts)-1]
+	// !p-2 in Tailwind v3 and p-2! in Tailwind v4
+	if strings.HasPrefix(u, "!") {
+		c.important = true
+		u = u[1:]
+	} else if strings.HasSuffix(u, "!") {
+		c.important = true
+		u = u[:len(u)-1]
+	}
+	c.base = u
+	if strings.HasPrefix(u, "-") {
+		c.negative = true
+		u = u[1:]
+	}
+	if u == "" {
+		return c, false
+	}
+
+	if u[0] == '[' {
+		// an arbitrary property (e.g., [mask-type:luminance])
+		end := strings.LastIndexByte(u, ']')
+		if end < 0 {
+			return c, false
+		}
+		prop, value, found := strings.Cut(u[1:end], ":")
+		if !found || prop == "" || value == "" || strings.ContainsAny(prop, "[]()") {
+			return c, false
+		}
+		c.root, c.value, c.arbitrary, c.property = prop, value, true, true
+		return c, true
+	}
+
+	if i := strings.Index(u, "-["); i >= 0 {
+		end := matchingBracket(u, i+1)
+		if end < 0 {
+			return c, false
+		}
+		c.root = u[:i]
+		c.value = u[i+2 : end]
+		c.arbitrary = true
+		rest := u[end+1:]
+		if rest != "" && (rest[0] != '/' || len(rest) == 1) {
+			return c, false
+		}
+		if rest != "" {
+			c.modifier = strings.Trim(rest[1:], "[]")
+		}
+		return c, true
+	}
+	if strings.ContainsAny(u, "[]") {
+		return c, false
+	}
+
+	// the root is found in the utility table, because both the root and the value can contain a dash (e.g., inset-x-2 or bg-red-500)
+	if slash := strings.LastIndexByte(u, '/'); slash >= 0 {
+		c.modifier = u[slash+1:]
+		u = u[:slash]
+	}
+	c.root, c.value = u, ""
+	for i := len(u); i > 0; i = strings.LastIndexByte(u[:i], '-') {
+		if _, ok := tailwindUtilities[u[:i]]; ok {
+			c.root = u[:i]
+			if i < len(u) {
+				c.value = u[i+1:]
+			}
+			break
+		}
+	}
+	return c, true
+}
+
+// splitTopLevel splits s around sep outside of brackets and parentheses.
+// It returns false if the brackets or parentheses are not balanced.
+func splitTopLevel(s string, sep byte) ([]string, bool) {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+			if depth < 0 {
+				return nil, false
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, false
+	}
+	return append(parts, s[start:]), true
+}
+
+// matchingBracket returns the index of the bracket that closes the bracket at s[open], or -1.
+func matchingBracket(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// properties returns the properties set by the class, or nil if they are not known.
+func (c tailwindClass) properties() []string {
+	if c.property {
+		return []string{c.root}
+	}
+	if c.value == "" && !c.arbitrary {
+		if props, ok := tailwindStatic[c.root]; ok {
+			return props
+		}
+	}
+	kind := c.kind()
+	for _, v := range tailwindUtilities[c.root] {
+		if v.matches(c, kind) {
+			if c.root == "text" && v.kind == kindLength && c.modifier != "" {
+				// text-sm/6 sets the line height as well
+				return append(slices.Clip(v.properties), "line-height")
+			}
+			return v.properties
+		}
+	}
+	return nil
+}
+
+// valueKind is the type of the value of a Tailwind class. It decides which property a utility sets (e.g., text-sm and text-red-500).
+type valueKind int
+
+const (
+	kindAny valueKind = iota
+	kindLength
+	kindNumber
+	kindColor
+	kindImage
+	kindPosition
+	kindSize
+	kindFamily
+)
+
+// tailwindHints are the type hints of arbitrary values (e.g., text-[length:var(--size)]).
+var tailwindHints = map[string]valueKind{
+	"length":      kindLength,
+	"percentage":  kindLength,
+	"number":      kindNumber,
+	"color":       kindColor,
+	"url":         kindImage,
+	"image":       kindImage,
+	"position":    kindPosition,
+	"size":        kindSize,
+	"family-name": kindFamily,
+}
+
+var lengthUnits = []string{
+	"%", "px", "rem", "em", "ex", "ch", "vh", "vw", "vmin", "vmax", "svh", "lvh", "dvh", "svw", "lvw", "dvw",
+	"cqw", "cqh", "cqi", "cqb", "cqmin", "cqmax", "cm", "mm", "in", "pt", "pc", "q", "lh", "rlh", "deg", "rad", "turn", "s", "ms",
+}
+
+// kind returns the type of the value of the class.
+func (c tailwindClass) kind() valueKind {
+	v := strings.ToLower(c.value)
+	if !c.arbitrary {
+		// named values: sizes and numbers, or a color of the theme (e.g., red-500 or primary)
+		switch {
+		case v == "" || v == "px" || v == "full" || v == "screen" || v == "auto" || v == "min" || v == "max" || v == "fit":
+			return kindLength
+		case v == "xs" || v == "sm" || v == "base" || v == "md" || v == "lg" || strings.HasSuffix(v, "xl"):
+			return kindLength
+		case v[0] >= '0' && v[0] <= '9':
+			return kindLength
+		}
+		return kindColor
+	}
+
+	if hint, rest, ok := strings.Cut(v, ":"); ok {
+		if kind, ok := tailwindHints[hint]; ok {
+			return kind
+		}
+		v = rest
+	}
+	switch {
+	case strings.HasPrefix(v, "#") || v == "transparent" || v == "currentcolor":
+		return kindColor
+	case strings.HasPrefix(v, "url(") || strings.Contains(v, "gradient(") || strings.HasPrefix(v, "image-set("):
+		return kindImage
+	}
+	if open := strings.IndexByte(v, '('); open > 0 {
+		switch v[:open] {
+		case "rgb", "rgba", "hsl", "hsla", "hwb", "lab", "lch", "oklab", "oklch", "color", "color-mix", "light-dark":
+			return kindColor
+		case "calc", "min", "max", "clamp":
+			return kindLength
+		}
+		return kindAny
+	}
+	number := strings.TrimLeft(v, "-+")
+	digits := strings.TrimLeft(number, "0123456789.")
+	switch {
+	case number == "" || digits == number:
+		return kindAny
+	case digits == "":
+		return kindNumber
+	case slices.Contains(lengthUnits, digits):
+		return kindLength
+	}
+	return kindAny
+}
+
+// tailwindValue is a property set by a utility for some values.
+type tailwindValue struct {
+	keywords   []string  // the named values that set the properties; if empty, kind decides
+	kind       valueKind // the kind of values that set the properties; kindAny matches every value
+	properties []string
+}
+
+func (v tailwindValue) matches(c tailwindClass, kind valueKind) bool {
+	if len(v.keywords) > 0 {
+		return !c.arbitrary && slices.Contains(v.keywords, c.value)
+	}
+	return v.kind == kindAny || v.kind == kind || v.kind == kindLength && kind == kindNumber
+}
+
+// values returns a value that sets the properties for every value.
+func values(properties ...string) []tailwindValue {
+	return []tailwindValue{{properties: properties}}
+}
+
+// tailwindStatic are the utilities without a value (e.g., flex or border) and the properties they set.
+var tailwindStatic = map[string][]string{
+	"block": {"display"}, "inline-block": {"display"}, "inline": {"display"}, "flex": {"display"}, "inline-flex": {"display"},
+	"grid": {"display"}, "inline-grid": {"display"}, "table": {"display"}, "contents": {"display"}, "hidden": {"display"},
+	"flow-root": {"display"}, "list-item": {"display"},
+	"static": {"position"}, "fixed": {"position"}, "absolute": {"position"}, "relative": {"position"}, "sticky": {"position"},
+	"visible": {"visibility"}, "invisible": {"visibility"}, "collapse": {"visibility"},
+	"italic": {"font-style"}, "not-italic": {"font-style"},
+	"underline": {"text-decoration-line"}, "overline": {"text-decoration-line"}, "line-through": {"text-decoration-line"}, "no-underline": {"text-decoration-line"},
+	"uppercase": {"text-transform"}, "lowercase": {"text-transform"}, "capitalize": {"text-transform"}, "normal-case": {"text-transform"},
+	"truncate": {"overflow", "text-overflow", "white-space"},
+	"border":   {"border-width"}, "border-x": {"border-left-width", "border-right-width"}, "border-y": {"border-top-width", "border-bottom-width"},
+	"border-t": {"border-top-width"}, "border-r": {"border-right-width"}, "border-b": {"border-bottom-width"}, "border-l": {"border-left-width"},
+	"rounded": {"border-radius"}, "shadow": {"box-shadow"}, "outline": {"outline-style"}, "transition": {"transition-property"},
+	"grow": {"flex-grow"}, "shrink": {"flex-shrink"},
+}
+
+// borderSide returns the values of a border utility for the border properties of some sides (e.g., "left" and "right" for border-x).
+func borderSide(sides ...string) []tailwindValue {
+	width := make([]string, len(sides))
+	color := make([]string, len(sides))
+	for i, side := range sides {
+		width[i] = "border-" + side + "-width"
+		color[i] = "border-" + side + "-color"
+	}
+	return []tailwindValue{
+		{kind: kindLength, properties: width},
+		{properties: color},
+	}
+}
+
+// tailwindUtilities are the utilities with a value and the properties they set, in the order they are tried.
+// Transforms, filters and rings are left out, because they set custom properties that differ between Tailwind versions.
+var tailwindUtilities = map[string][]tailwindValue{
+	"p": values("padding"), "px": values("padding-left", "padding-right"), "py": values("padding-top", "padding-bottom"),
+	"pt": values("padding-top"), "pr": values("padding-right"), "pb": values("padding-bottom"), "pl": values("padding-left"),
+	"ps": values("padding-inline-start"), "pe": values("padding-inline-end"),
+	"m": values("margin"), "mx": values("margin-left", "margin-right"), "my": values("margin-top", "margin-bottom"),
+	"mt": values("margin-top"), "mr": values("margin-right"), "mb": values("margin-bottom"), "ml": values("margin-left"),
+	"ms": values("margin-inline-start"), "me": values("margin-inline-end"),
+	"gap": values("gap"), "gap-x": values("column-gap"), "gap-y": values("row-gap"),
+
+	"w": values("width"), "min-w": values("min-width"), "max-w": values("max-width"),
+	"h": values("height"), "min-h": values("min-height"), "max-h": values("max-height"),
+	"size": values("width", "height"),
+
+	"inset": values("inset"), "inset-x": values("left", "right"), "inset-y": values("top", "bottom"),
+	"top": values("top"), "right": values("right"), "bottom": values("bottom"), "left": values("left"),
+	"start": values("inset-inline-start"), "end": values("inset-inline-end"),
+	"z": values("z-index"), "order": values("order"), "opacity": values("opacity"),
+
+	"flex": {
+		{keywords: []string{"row", "row-reverse", "col", "col-reverse"}, properties: []string{"flex-direction"}},
+		{keywords: []string{"wrap", "wrap-reverse", "nowrap"}, properties: []string{"flex-wrap"}},
+		{properties: []string{"flex"}},
+	},
+	"basis": values("flex-basis"), "grow": values("flex-grow"), "shrink": values("flex-shrink"),
+	"grid-cols": values("grid-template-columns"), "grid-rows": values("grid-template-rows"),
+	"col": values("grid-column"), "col-span": values("grid-column"), "col-start": values("grid-column-start"), "col-end": values("grid-column-end"),
+	"row": values("grid-row"), "row-span": values("grid-row"), "row-start": values("grid-row-start"), "row-end": values("grid-row-end"),
+	"justify": values("justify-content"), "items": values("align-items"), "self": values("align-self"),
+	"content": {
+		{keywords: []string{"normal", "center", "start", "end", "between", "around", "evenly", "baseline", "stretch"}, properties: []string{"align-content"}},
+		{properties: []string{"content"}},
+	},
+	"place-content": values("place-content"), "place-items": values("place-items"), "place-self": values("place-self"),
+	"aspect": values("aspect-ratio"), "columns": values("columns"),
+
+	"text": {
+		{keywords: []string{"left", "center", "right", "justify", "start", "end"}, properties: []string{"text-align"}},
+		{keywords: []string{"ellipsis", "clip"}, properties: []string{"text-overflow"}},
+		{keywords: []string{"wrap", "nowrap", "balance", "pretty"}, properties: []string{"text-wrap"}},
+		{kind: kindLength, properties: []string{"font-size"}},
+		{properties: []string{"color"}},
+	},
+	"font": {
+		{keywords: []string{"thin", "extralight", "light", "normal", "medium", "semibold", "bold", "extrabold", "black"}, properties: []string{"font-weight"}},
+		{kind: kindNumber, properties: []string{"font-weight"}},
+		{properties: []string{"font-family"}},
+	},
+	"leading": values("line-height"), "tracking": values("letter-spacing"), "indent": values("text-indent"),
+	"decoration": {
+		{keywords: []string{"solid", "double", "dotted", "dashed", "wavy"}, properties: []string{"text-decoration-style"}},
+		{keywords: []string{"auto", "from-font"}, properties: []string{"text-decoration-thickness"}},
+		{kind: kindLength, properties: []string{"text-decoration-thickness"}},
+		{properties: []string{"text-decoration-color"}},
+	},
+	"underline-offset": values("text-underline-offset"),
+
+	"bg": {
+		{keywords: []string{"fixed", "local", "scroll"}, properties: []string{"background-attachment"}},
+		{keywords: []string{"auto", "cover", "contain"}, properties: []string{"background-size"}},
+		{keywords: []string{"bottom", "center", "left", "left-bottom", "left-top", "right", "right-bottom", "right-top", "top"}, properties: []string{"background-position"}},
+		{keywords: []string{"repeat", "no-repeat", "repeat-x", "repeat-y", "repeat-round", "repeat-space"}, properties: []string{"background-repeat"}},
+		{keywords: []string{"none", "gradient-to-t", "gradient-to-tr", "gradient-to-r", "gradient-to-br", "gradient-to-b", "gradient-to-bl", "gradient-to-l", "gradient-to-tl"}, properties: []string{"background-image"}},
+		{kind: kindImage, properties: []string{"background-image"}},
+		{kind: kindPosition, properties: []string{"background-position"}},
+		{kind: kindSize, properties: []string{"background-size"}},
+		{properties: []string{"background-color"}},
+	},
+
+	"border": {
+		{keywords: []string{"solid", "dashed", "dotted", "double", "hidden", "none"}, properties: []string{"border-style"}},
+		{kind: kindLength, properties: []string{"border-width"}},
+		{properties: []string{"border-color"}},
+	},
+	"border-x": borderSide("left", "right"), "border-y": borderSide("top", "bottom"),
+	"border-t": borderSide("top"), "border-r": borderSide("right"), "border-b": borderSide("bottom"), "border-l": borderSide("left"),
+	"rounded":   values("border-radius"),
+	"rounded-t": values("border-top-left-radius", "border-top-right-radius"), "rounded-r": values("border-top-right-radius", "border-bottom-right-radius"),
+	"rounded-b": values("border-bottom-right-radius", "border-bottom-left-radius"), "rounded-l": values("border-top-left-radius", "border-bottom-left-radius"),
+	"rounded-tl": values("border-top-left-radius"), "rounded-tr": values("border-top-right-radius"),
+	"rounded-br": values("border-bottom-right-radius"), "rounded-bl": values("border-bottom-left-radius"),
+	"outline": {
+		{keywords: []string{"none", "dashed", "dotted", "double"}, properties: []string{"outline-style"}},
+		{kind: kindLength, properties: []string{"outline-width"}},
+		{properties: []string{"outline-color"}},
+	},
+	"outline-offset": values("outline-offset"),
+	"shadow": {
+		{kind: kindColor, properties: []string{"--tw-shadow-color"}},
+		{properties: []string{"box-shadow"}},
+	},
+
+	"fill": values("fill"),
+	"stroke": {
+		{kind: kindLength, properties: []string{"stroke-width"}},
+		{properties: []string{"stroke"}},
+	},
+	"cursor":   values("cursor"),
+	"duration": values("transition-duration"), "delay": values("transition-delay"), "ease": values("transition-timing-function"),
+	"transition": values("transition-property"),
+}
@@ -0,0 +1,172 @@
+package merge
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTailwindClass(t *testing.T) {
+	tt := []struct {
+		in   string
+		want tailwindClass
+		fail bool
+	}{
+		{in: "p-2", want: tailwindClass{base: "p-2", root: "p", value: "2"}},
+		{in: "inset-x-2", want: tailwindClass{base: "inset-x-2", root: "inset-x", value: "2"}},
+		{in: "bg-red-500/50", want: tailwindClass{base: "bg-red-500/50", root: "bg", value: "red-500", modifier: "50"}},
+		{in: "w-1/2", want: tailwindClass{base: "w-1/2", root: "w", value: "1", modifier: "2"}},
+		{in: "flex", want: tailwindClass{base: "flex", root: "flex"}},
+		{in: "p-[13px]", want: tailwindClass{base: "p-[13px]", root: "p", value: "13px", arbitrary: true}},
+		{in: "bg-[#123456]/[0.5]", want: tailwindClass{base: "bg-[#123456]/[0.5]", root: "bg", value: "#123456", arbitrary: true, modifier: "0.5"}},
+		{in: "grid-cols-[repeat(2,minmax(0,1fr))]", want: tailwindClass{base: "grid-cols-[repeat(2,minmax(0,1fr))]", root: "grid-cols", value: "repeat(2,minmax(0,1fr))", arbitrary: true}},
+		{in: "[mask-type:luminance]", want: tailwindClass{base: "[mask-type:luminance]", root: "mask-type", value: "luminance", arbitrary: true, property: true}},
+		{
+			in:   "md:hover:!-mt-[3px]",
+			want: tailwindClass{variants: []string{"md", "hover"}, important: true, negative: true, base: "-mt-[3px]", root: "mt", value: "3px", arbitrary: true},
+		},
+		{in: "hover:p-3!", want: tailwindClass{variants: []string{"hover"}, important: true, base: "p-3", root: "p", value: "3"}},
+		{in: "[&>*:hover]:p-2", want: tailwindClass{variants: []string{"[&>*:hover]"}, base: "p-2", root: "p", value: "2"}},
+		{in: "p-[13px", fail: true},
+		{in: "hover:", fail: true},
+		{in: "[mask-type]", fail: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			got, ok := parseTailwindClass(tc.in)
+			if ok == tc.fail {
+				t.Fatalf("parseTailwindClass returned %v, want %v", ok, !tc.fail)
+			}
+			if ok && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseTailwindClass returned %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTailwindClassProperties(t *testing.T) {
+	tt := []struct {
+		in   string
+		want []string
+	}{
+		{in: "p-[13px]", want: []string{"padding"}},
+		{in: "text-[13px]", want: []string{"font-size"}},
+		{in: "text-[length:var(--size)]", want: []string{"font-size"}},
+		{in: "text-[#123]", want: []string{"color"}},
+		{in: "text-[var(--color)]", want: []string{"color"}},
+		{in: "text-sm/6", want: []string{"font-size", "line-height"}},
+		{in: "text-center", want: []string{"text-align"}},
+		{in: "text-primary", want: []string{"color"}},
+		{in: "bg-[url(/img.png)]", want: []string{"background-image"}},
+		{in: "bg-[rgb(0,0,0)]", want: []string{"background-color"}},
+		{in: "bg-cover", want: []string{"background-size"}},
+		{in: "border-[3px]", want: []string{"border-width"}},
+		{in: "border-x-[#fff]", want: []string{"border-left-color", "border-right-color"}},
+		{in: "font-[600]", want: []string{"font-weight"}},
+		{in: "font-[Inter]", want: []string{"font-family"}},
+		{in: "flex-col", want: []string{"flex-direction"}},
+		{in: "flex-[2_2_0%]", want: []string{"flex"}},
+		{in: "inline-flex", want: []string{"display"}},
+		{in: "[--gap:1rem]", want: []string{"--gap"}},
+		{in: "card", want: nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			c, ok := parseTailwindClass(tc.in)
+			if !ok {
+				t.Fatal("parseTailwindClass returned false")
+			}
+			if got := c.properties(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("properties returned %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeTailwindFallback(t *testing.T) {
+	tt := []struct {
+		in   string
+		want string
+	}{
+		{in: "p-2 p-[13px]", want: "p-[13px]"},
+		{in: "p-[13px] p-2", want: "p-2"},
+		{in: "p-[13px] px-2", want: "p-[13px] px-2"},
+		{in: "px-2 p-[13px]", want: "p-[13px]"},
+		{in: "bg-red-500 bg-[#123456]", want: "bg-[#123456]"},
+		{in: "bg-[#123456] bg-[url(/img.png)]", want: "bg-[#123456] bg-[url(/img.png)]"},
+		{in: "text-red-500 text-[13px]", want: "text-red-500 text-[13px]"},
+		{in: "text-lg text-[13px]", want: "text-[13px]"},
+		{in: "[mask-type:luminance] [mask-type:alpha]", want: "[mask-type:alpha]"},
+		{in: "[padding:1px] p-2", want: "p-2"},
+		{in: "hover:p-2 hover:p-[13px]", want: "hover:p-[13px]"},
+		{in: "p-2 hover:p-[13px]", want: "p-2 hover:p-[13px]"},
+		{in: "hover:p-2 hover:!p-3", want: "hover:!p-3"},
+		{in: "-m-2 -m-[3px]", want: "-m-[3px]"},
+		{in: "[&>*]:p-2 [&>*]:p-[13px]", want: "[&>*]:p-[13px]"},
+		{in: "unknown p-2 other-unknown", want: "unknown p-2 other-unknown"},
+	}
+
+	by, err := os.ReadFile("./internal/cascadia/test_resources/test_output.css")
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	for _, stylesheet := range []string{"v3", "v4"} {
+		if stylesheet == "v4" {
+			// the v4 stylesheet is only used to learn the variants, the classes are the same as in v3
+			if by, err = os.ReadFile("./internal/cascadia/test_resources/test_output_v4.css"); err != nil {
+				t.Fatalf("ReadFile returned error: %v", err)
+			}
+		}
+		r := NewMerger(nil, true)
+		if err := r.AddRules(strings.NewReader(string(by)), false); err != nil {
+			t.Fatalf("AddRules returned error: %v", err)
+		}
+		r.SetTailwindFallback(true)
+		for _, tc := range tt {
+			t.Run(stylesheet+"/"+tc.in, func(t *testing.T) {
+				if got := r.Merge(tc.in); got != tc.want {
+					t.Errorf("Merge(%q) returned %q, want %q", tc.in, got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+func TestSetTailwindFallback(t *testing.T) {
+	r := NewMerger(NewCache(), true)
+	err := r.AddRules(strings.NewReader(`.p-2 { padding: 0.5rem; } .hover\:p-2:hover { padding: 0.5rem; }`), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	if got := r.Merge("p-2 p-[13px]"); got != "p-2 p-[13px]" {
+		t.Errorf("Merge without the fallback returned %q, want %q", got, "p-2 p-[13px]")
+	}
+	r.SetTailwindFallback(true)
+	if got := r.Merge("p-2 p-[13px]"); got != "p-[13px]" {
+		t.Errorf("Merge with the fallback returned %q, want %q", got, "p-[13px]")
+	}
+
+	// the variants are learned again when rules are added
+	err = r.AddRules(strings.NewReader(`@media (min-width: 768px) { .md\:p-2 { padding: 0.5rem; } }`), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	if got := r.Merge("md:p-2 md:p-[13px] hover:p-[1px]"); got != "md:p-[13px] hover:p-[1px]" {
+		t.Errorf("Merge returned %q, want %q", got, "md:p-[13px] hover:p-[1px]")
+	}
+
+	// padding sets the four physical sides, and the four logical sides whatever the direction (see SetDirection)
+	exp := r.Explain("p-2 p-[13px]")
+	if c := exp.Classes[1]; c.Known || !c.Inferred || !c.Kept || len(c.Conflicts) != 8 {
+		t.Errorf("Explain returned %+v, want an inferred class that wins 8 properties", c)
+	}
+
+	r.SetTailwindFallback(false)
+	if got := r.Merge("p-2 p-[13px]"); got != "p-2 p-[13px]" {
+		t.Errorf("Merge without the fallback returned %q, want %q", got, "p-2 p-[13px]")
+	}
+}
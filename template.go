@@ -0,0 +1,40 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tylantz/go-tailwind-merge/internal/classlist"
+)
+
+// FuncMap returns template functions bound to the Merger.
+// The map can be passed to the Funcs method of both html/template and text/template.
+//
+// twMerge joins its arguments into a class list and merges it (see Merge). The arguments can be:
+//   - a string of space-separated classes
+//   - a []string or []any of arguments
+//   - a map[string]bool of conditional classes: a key is added if its value is true. Keys are added in alphabetical order.
+//   - nil, which is skipped
+//
+// twMerge returns a plain string, so html/template escapes it for the context it is used in
+// and it is safe to use as an attribute value (e.g., class="{{ twMerge .Base .Class }}").
+func (r *Merger) FuncMap() map[string]any {
+	return map[string]any{
+		"twMerge": r.mergeArgs,
+	}
+}
+
+func (r *Merger) mergeArgs(args ...any) (string, error) {
+	classes, err := joinClasses(nil, args)
+	if err != nil {
+		return "", err
+	}
+	return r.Merge(strings.Join(classes, " ")), nil
+}
+
+// joinClasses appends the classes of template arguments to classes.
+func joinClasses(classes []string, args []any) ([]string, error) {
+	return classlist.Append(classes, args, func(_ []string, arg any) ([]string, error) {
+		return nil, fmt.Errorf("twMerge: unsupported argument type %T", arg)
+	})
+}
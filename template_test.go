@@ -0,0 +1,123 @@
+package merge
+
+import (
+	htmltemplate "html/template"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+)
+
+const templateRules = `
+.p-1 {
+	padding: 0.25rem;
+}
+.p-2 {
+	padding: 0.5rem;
+}
+.bg-red {
+	background-color: red;
+}
+.bg-blue {
+	background-color: blue;
+}
+`
+
+func TestFuncMapHTMLTemplate(t *testing.T) {
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(templateRules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	tt := []struct {
+		name string
+		tmpl string
+		data any
+		want string
+	}{
+		{
+			name: "strings",
+			tmpl: `<div class="{{ twMerge "p-1 bg-red" .Class }}"></div>`,
+			data: map[string]any{"Class": "p-2"},
+			want: `<div class="bg-red p-2"></div>`,
+		},
+		{
+			name: "slice",
+			tmpl: `<div class="{{ twMerge .Base .Class }}"></div>`,
+			data: map[string]any{"Base": []string{"p-1", "bg-red"}, "Class": "bg-blue"},
+			want: `<div class="p-1 bg-blue"></div>`,
+		},
+		{
+			name: "conditional",
+			tmpl: `<div class="{{ twMerge "p-1 bg-red" .Active }}"></div>`,
+			data: map[string]any{"Active": map[string]bool{"bg-blue": true, "p-2": false}},
+			want: `<div class="p-1 bg-blue"></div>`,
+		},
+		{
+			name: "nil",
+			tmpl: `<div class="{{ twMerge "p-1" .Missing }}"></div>`,
+			data: map[string]any{},
+			want: `<div class="p-1"></div>`,
+		},
+		{
+			name: "escaped attribute",
+			tmpl: `<div class="{{ twMerge "p-1" .Class }}"></div>`,
+			data: map[string]any{"Class": `"><script>alert(1)</script>`},
+			want: `<div class="p-1 &#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"></div>`,
+		},
+		{
+			name: "unquoted attribute",
+			tmpl: `<div class={{ twMerge "p-1 bg-red" .Class }}></div>`,
+			data: map[string]any{"Class": "p-2"},
+			want: `<div class=bg-red&#32;p-2></div>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := htmltemplate.New(tc.name).Funcs(r.FuncMap()).Parse(tc.tmpl)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			b := strings.Builder{}
+			err = tmpl.Execute(&b, tc.data)
+			if err != nil {
+				t.Fatalf("Execute returned error: %v", err)
+			}
+			if b.String() != tc.want {
+				t.Errorf("Execute rendered %q, want %q", b.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestFuncMapTextTemplate(t *testing.T) {
+	r := NewMerger(nil, true)
+	err := r.AddRules(strings.NewReader(templateRules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+
+	tmpl, err := texttemplate.New("text").Funcs(r.FuncMap()).Parse(`{{ twMerge "p-1 bg-red" .Class .Extra }}`)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	b := strings.Builder{}
+	err = tmpl.Execute(&b, map[string]any{"Class": []any{"p-2", map[string]bool{"bg-blue": true}}, "Extra": "unknown"})
+	if err != nil {
+		t.Fatalf("Execute returned error: %v", err)
+	}
+	if want := "p-2 bg-blue unknown"; b.String() != want {
+		t.Errorf("Execute rendered %q, want %q", b.String(), want)
+	}
+
+	// unsupported arguments fail the template
+	tmpl, err = texttemplate.New("error").Funcs(r.FuncMap()).Parse(`{{ twMerge "p-1" 1 }}`)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	err = tmpl.Execute(&b, nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported argument type int") {
+		t.Errorf("Execute returned error %v, want unsupported argument type", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Package tw merges class lists in templ components.
+//
+// It accepts the same values as templ.Classes (strings, templ.KV, map[string]bool, templ.CSSClass values and slices of them)
+// and returns a Class, which implements templ.CSSClass so it can be used in a class attribute:
+//
+//	<button class={ tw.Merge("px-4 py-2 bg-green-500", props.Class, templ.KV("opacity-50", props.Disabled)) }>
+//
+// The package does not depend on templ. templ.KV values are recognised by their Key and Value fields
+// and templ.CSSClass values by their ClassName method.
+package tw
+
+import (
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	merge "github.com/tylantz/go-tailwind-merge"
+	"github.com/tylantz/go-tailwind-merge/internal/classlist"
+)
+
+// UnknownTypeClass is added in place of a value of an unsupported type, like templ does.
+const UnknownTypeClass = "--templ-css-class-unknown-type"
+
+// CSSClass is a class with a name. It is the templ.CSSClass interface.
+type CSSClass interface {
+	ClassName() string
+}
+
+// Class is a merged class list.
+type Class string
+
+// ClassName returns the class list. It implements templ.CSSClass.
+func (c Class) ClassName() string {
+	return string(c)
+}
+
+func (c Class) String() string {
+	return string(c)
+}
+
+// Merger merges templ class values with a merge.Merger.
+type Merger struct {
+	merger *merge.Merger
+}
+
+// New creates a Merger that merges classes with m.
+func New(m *merge.Merger) *Merger {
+	return &Merger{merger: m}
+}
+
+// Merge joins the class values and merges them.
+// See the package documentation for the values that are accepted.
+func (t *Merger) Merge(classes ...any) Class {
+	joined := strings.Join(appendClasses(nil, classes), " ")
+	if t == nil || t.merger == nil {
+		return Class(joined)
+	}
+	return Class(t.merger.Merge(joined))
+}
+
+var defaultMerger atomic.Pointer[Merger]
+
+// SetMerger sets the merge.Merger used by Merge.
+// It is usually called once, after the stylesheets are added to m.
+func SetMerger(m *merge.Merger) {
+	defaultMerger.Store(New(m))
+}
+
+// Merge joins the class values and merges them with the merge.Merger set with SetMerger.
+// The classes are only joined if no merger is set.
+func Merge(classes ...any) Class {
+	return defaultMerger.Load().Merge(classes...)
+}
+
+var cssClassType = reflect.TypeOf((*CSSClass)(nil)).Elem()
+
+// appendClasses appends the class names of templ class values to classes.
+func appendClasses(classes []string, values []any) []string {
+	for _, value := range values {
+		classes = appendClass(classes, value)
+	}
+	return classes
+}
+
+func appendClass(classes []string, value any) []string {
+	classes, _ = classlist.Append(classes, value, appendOther)
+	return classes
+}
+
+// appendOther appends the class names of the templ class values that classlist.Append does not know to classes.
+func appendOther(classes []string, value any) ([]string, error) {
+	if c, ok := value.(CSSClass); ok {
+		return append(classes, strings.Fields(c.ClassName())...), nil
+	}
+
+	// templ.KeyValue and the slice types of templ are generic or named, so they are matched by their shape
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			classes = appendClass(classes, v.Index(i).Interface())
+		}
+		return classes, nil
+	case reflect.Struct:
+		if key, ok, isKV := keyValue(v); isKV {
+			if ok {
+				return appendClass(classes, key), nil
+			}
+			return classes, nil
+		}
+	}
+	return append(classes, UnknownTypeClass), nil
+}
+
+// keyValue returns the key and the value of a templ.KeyValue with a class as key and a bool as value
+// (e.g., templ.KV("p-2", true)). isKV is false if v is not such a key-value pair.
+func keyValue(v reflect.Value) (key any, value bool, isKV bool) {
+	k := v.FieldByName("Key")
+	val := v.FieldByName("Value")
+	if !k.IsValid() || !val.IsValid() || !k.CanInterface() || val.Kind() != reflect.Bool {
+		return nil, false, false
+	}
+	switch {
+	case k.Type().Implements(cssClassType):
+		key = k.Interface()
+	case k.Kind() == reflect.String:
+		key = k.String()
+	default:
+		return nil, false, false
+	}
+	return key, val.Bool(), true
+}
@@ -0,0 +1,121 @@
+package tw
+
+import (
+	"strings"
+	"testing"
+
+	merge "github.com/tylantz/go-tailwind-merge"
+)
+
+// The types below are a stub of the class types of templ (github.com/a-h/templ).
+
+type stubConstantCSSClass string
+
+func (c stubConstantCSSClass) ClassName() string {
+	return string(c)
+}
+
+type stubComponentCSSClass struct {
+	ID string
+}
+
+func (c stubComponentCSSClass) ClassName() string {
+	return c.ID
+}
+
+type stubKeyValue[TKey comparable, TValue any] struct {
+	Key   TKey
+	Value TValue
+}
+
+func stubKV[TKey comparable, TValue any](key TKey, value TValue) stubKeyValue[TKey, TValue] {
+	return stubKeyValue[TKey, TValue]{Key: key, Value: value}
+}
+
+type stubCSSClasses []any
+
+// stubClasses renders a class attribute value like templ.Classes(...).String() does for the values used here.
+func stubClasses(classes ...any) string {
+	names := make([]string, 0, len(classes))
+	for _, c := range classes {
+		names = append(names, c.(CSSClass).ClassName())
+	}
+	return strings.Join(names, " ")
+}
+
+const rules = `
+.p-1 {
+	padding: 0.25rem;
+}
+.p-2 {
+	padding: 0.5rem;
+}
+.bg-red {
+	background-color: red;
+}
+.bg-blue {
+	background-color: blue;
+}
+.opacity-50 {
+	opacity: 0.5;
+}
+`
+
+func newMerger(t *testing.T) *merge.Merger {
+	t.Helper()
+	m := merge.NewMerger(nil, true)
+	err := m.AddRules(strings.NewReader(rules), false)
+	if err != nil {
+		t.Fatalf("AddRules returned error: %v", err)
+	}
+	return m
+}
+
+func TestMerge(t *testing.T) {
+	tw := New(newMerger(t))
+
+	tt := []struct {
+		name    string
+		classes []any
+		want    string
+	}{
+		{name: "strings", classes: []any{"p-1 bg-red", "p-2"}, want: "bg-red p-2"},
+		{name: "empty", classes: []any{"p-1", "", nil}, want: "p-1"},
+		{name: "kv", classes: []any{"p-1 bg-red", stubKV("bg-blue", true), stubKV("p-2", false)}, want: "p-1 bg-blue"},
+		{name: "kv with class key", classes: []any{"p-1", stubKV[CSSClass](stubConstantCSSClass("p-2"), true)}, want: "p-2"},
+		{name: "map", classes: []any{"p-1 bg-red", map[string]bool{"p-2": true, "bg-blue": true, "opacity-50": false}}, want: "bg-blue p-2"},
+		{name: "constant class", classes: []any{"p-1", stubConstantCSSClass("p-2")}, want: "p-2"},
+		{name: "component class", classes: []any{stubComponentCSSClass{ID: "card_1a2b"}, "p-1"}, want: "card_1a2b p-1"},
+		{name: "classes", classes: []any{"p-1", stubCSSClasses{"bg-red", stubKV("p-2", true)}}, want: "bg-red p-2"},
+		{name: "slice of kv", classes: []any{"p-1", []stubKeyValue[string, bool]{stubKV("p-2", true), stubKV("opacity-50", false)}}, want: "p-2"},
+		{name: "string slice", classes: []any{[]string{"p-1", "p-2 bg-red"}}, want: "p-2 bg-red"},
+		{name: "merged class", classes: []any{Class("p-1 bg-red"), "bg-blue"}, want: "p-1 bg-blue"},
+		{name: "unknown type", classes: []any{"p-1", 42}, want: "p-1 " + UnknownTypeClass},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tw.Merge(tc.classes...)
+			if got.String() != tc.want {
+				t.Errorf("Merge(%v) = %q, want %q", tc.classes, got, tc.want)
+			}
+			// the result can be used as a templ class
+			if rendered := stubClasses(got); rendered != tc.want {
+				t.Errorf("Merge(%v) rendered %q, want %q", tc.classes, rendered, tc.want)
+			}
+		})
+	}
+}
+
+func TestSetMerger(t *testing.T) {
+	defer defaultMerger.Store(nil)
+
+	// without a merger the classes are joined
+	if got := Merge("p-1", "p-2"); got != "p-1 p-2" {
+		t.Errorf("Merge without merger = %q, want %q", got, "p-1 p-2")
+	}
+
+	SetMerger(newMerger(t))
+	if got := Merge("p-1", "p-2"); got != "p-2" {
+		t.Errorf("Merge = %q, want %q", got, "p-2")
+	}
+}
@@ -0,0 +1,158 @@
+package merge
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tylantz/go-tailwind-merge/internal/cascadia"
+)
+
+// FileWatcher reloads the rules of a Merger when stylesheet files change (see Merger.WatchFiles).
+type FileWatcher struct {
+	merger   *Merger
+	paths    []string
+	interval time.Duration
+	onError  func(error)
+
+	mu     sync.Mutex  // serializes reloads
+	stamps []fileStamp // the state of each file at the last reload
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// fileStamp is what is compared to find out whether a file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	missing bool
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{missing: true}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// WatchFiles replaces the rules of the Merger with the rules of the stylesheet files at paths,
+// and polls the files every interval to load them again when one of them changes (e.g., when the Tailwind CLI rewrites its output).
+// Polling works on every file system, including mounted volumes where file events are not available.
+//
+// On a change, every file is parsed again and the rules are replaced as a whole (see AddRules), which clears the cache.
+// Rules added before with AddRules are replaced as well.
+// Each file is a source named by its path (see Sources).
+// If a file cannot be read or parsed, onError is called with the error (a *SourceError), if it is not nil, and the Merger keeps the last rules that loaded.
+// The error of the first load is returned, in which case nothing is watched.
+// An interval that is not positive is an error, and nothing is loaded.
+// Stop must be called to stop polling.
+func (r *Merger) WatchFiles(interval time.Duration, onError func(error), paths ...string) (*FileWatcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("watch interval %v is not positive", interval)
+	}
+	w := &FileWatcher{
+		merger:   r,
+		paths:    paths,
+		interval: interval,
+		onError:  onError,
+		stamps:   make([]fileStamp, len(paths)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *FileWatcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if !w.changed() {
+				continue
+			}
+			if err := w.Reload(); err != nil && w.onError != nil {
+				w.onError(err)
+			}
+		}
+	}
+}
+
+// changed returns whether a file changed since the last reload.
+func (w *FileWatcher) changed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, path := range w.paths {
+		if statFile(path) != w.stamps[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload parses every file and replaces the rules of the Merger, whether the files changed or not.
+// If a file cannot be read or parsed, the error is returned and the Merger keeps its rules.
+// A file that fails is not loaded again until it changes.
+func (w *FileWatcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sheets := make([]cascadia.Stylesheet, 0, len(w.paths))
+	var firstErr error
+	for i, path := range w.paths {
+		// the file is stamped before it is read, so a write during the read is seen as a change by the next poll
+		w.stamps[i] = statFile(path)
+		sheet, err := parseFile(path)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		sheets = append(sheets, sheet)
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	r := w.merger
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := newRuleSet()
+	for i, sheet := range sheets {
+		next.addSource(w.paths[i], sheet)
+	}
+	r.publish(next)
+	return nil
+}
+
+// parseFile parses the stylesheet file at path. The error is a *SourceError.
+func parseFile(path string) (cascadia.Stylesheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cascadia.Stylesheet{}, &SourceError{Source: path, Err: err}
+	}
+	defer f.Close()
+	sheet, err := cascadia.ExtractStylesheet(f, false)
+	if err != nil {
+		return cascadia.Stylesheet{}, &SourceError{Source: path, Err: err}
+	}
+	return sheet, nil
+}
+
+// Stop stops polling the files. The Merger keeps the rules that are loaded.
+// It waits for a reload in progress to finish.
+func (w *FileWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
@@ -0,0 +1,130 @@
+package merge
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeStylesheet writes a file with a modification time that is different from the last write,
+// because the modification times of quick writes can be the same.
+func writeStylesheet(t *testing.T, path, css string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(css), 0o644); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes returned error: %v", err)
+	}
+}
+
+// waitForMerge merges in until the result is want or the deadline passes.
+func waitForMerge(t *testing.T, r *Merger, in, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	got := r.Merge(in)
+	for got != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		got = r.Merge(in)
+	}
+	if got != want {
+		t.Fatalf("Merge(%q) returned %q, want %q", in, got, want)
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.css")
+	custom := filepath.Join(dir, "custom.css")
+	start := time.Now().Add(-time.Hour)
+	writeStylesheet(t, output, `.p-1 { padding: 0.25rem; } .p-2 { padding: 0.5rem; }`, start)
+	writeStylesheet(t, custom, `.m-1 { margin: 0.25rem; } .m-2 { margin: 0.5rem; }`, start)
+
+	errs := make(chan error, 10)
+	r := NewMerger(NewCache(), true)
+	w, err := r.WatchFiles(time.Millisecond, func(err error) { errs <- err }, output, custom)
+	if err != nil {
+		t.Fatalf("WatchFiles returned error: %v", err)
+	}
+	defer w.Stop()
+
+	if got := r.Merge("p-1 p-2 m-1 m-2"); got != "p-2 m-2" {
+		t.Fatalf("Merge returned %q, want %q", got, "p-2 m-2")
+	}
+
+	// a changed file replaces the rules and clears the cache
+	writeStylesheet(t, output, `.p-1 { padding: 0.25rem; } .px-2 { padding-left: 0.5rem; padding-right: 0.5rem; }`, start.Add(time.Minute))
+	waitForMerge(t, r, "p-1 p-2 m-1 m-2", "p-1 p-2 m-2")
+
+	// a file that fails to parse keeps the last rules
+	writeStylesheet(t, custom, `.m-1 { margin: 0.25rem; }}`, start.Add(2*time.Minute))
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "custom.css") {
+			t.Errorf("onError got %v, want the name of the file", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onError was not called")
+	}
+	if got := r.Merge("p-1 px-2 m-1 m-2"); got != "p-1 px-2 m-2" {
+		t.Errorf("Merge returned %q, want %q", got, "p-1 px-2 m-2")
+	}
+
+	// a missing file is an error as well
+	if err := os.Remove(custom); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("onError got %v, want a missing file", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onError was not called")
+	}
+
+	// the rules load again once the file is fixed
+	writeStylesheet(t, custom, `.m-2 { margin: 0.5rem; } .m-3 { margin: 0.75rem; }`, start.Add(3*time.Minute))
+	waitForMerge(t, r, "m-1 m-2 m-3", "m-1 m-3")
+
+	w.Stop()
+	writeStylesheet(t, custom, `.m-1 { margin: 0.25rem; } .m-2 { margin: 0.5rem; }`, start.Add(4*time.Minute))
+	time.Sleep(20 * time.Millisecond)
+	if got := r.Merge("m-1 m-2 m-3"); got != "m-1 m-3" {
+		t.Errorf("Merge after Stop returned %q, want %q", got, "m-1 m-3")
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("onError got unexpected error %v", err)
+	default:
+	}
+}
+
+func TestWatchFilesInitialError(t *testing.T) {
+	r := NewMerger(nil, true)
+	_, err := r.WatchFiles(time.Millisecond, nil, filepath.Join(t.TempDir(), "missing.css"))
+	if err == nil {
+		t.Fatal("WatchFiles returned no error for a missing file")
+	}
+}
+
+func TestWatchFilesZeroInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.css")
+	writeStylesheet(t, path, `.p-1 { padding: 0.25rem; } .p-2 { padding: 0.5rem; }`, time.Now())
+
+	r := NewMerger(nil, true)
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if w, err := r.WatchFiles(interval, nil, path); err == nil {
+			w.Stop()
+			t.Fatalf("WatchFiles returned no error for the interval %v", interval)
+		}
+	}
+	// nothing is loaded
+	if got := r.Merge("p-1 p-2"); got != "p-1 p-2" {
+		t.Errorf("Merge returned %q, want %q", got, "p-1 p-2")
+	}
+}